@@ -3,14 +3,29 @@ package config
 import (
 	"log"
 	"os"
+	"time"
 
 	"github.com/joho/godotenv"
 )
 
 type Config struct {
-	Port        string
-	MongoURL    string
-	MongoDBName string
+	Port           string
+	MongoURL       string
+	MongoDBName    string
+	IdempotencyTTL time.Duration
+	ReservationTTL time.Duration
+
+	PaymentProvider      string
+	PaymentWebhookSecret string
+	PaymentFakeOutcomes  string // e.g. "authorize=decline,capture=pending"
+	PaymentWebhookURL    string // where the fake provider posts its webhooks
+
+	ShippingRates string // e.g. "free_over:1000,flat:50", see shipping.Parse
+	TaxMode       string // "inclusive" or "exclusive"
+	TaxRates      string // e.g. "7,category:books=0", see tax.Parse
+
+	GuestMergeCampaigns string // "keep", "add" or "replace"
+	GuestMergePoints    string // "none", "all" or a number of points
 }
 
 func LoadConfig() Config {
@@ -31,9 +46,62 @@ func LoadConfig() Config {
 		log.Println("WARNING: MONGO_DB_NAME is empty")
 	}
 
+	idempotencyTTL := 24 * time.Hour
+	if raw := os.Getenv("IDEMPOTENCY_TTL"); raw != "" {
+		if ttl, err := time.ParseDuration(raw); err == nil && ttl > 0 {
+			idempotencyTTL = ttl
+		} else {
+			log.Printf("WARNING: invalid IDEMPOTENCY_TTL %q, using %s", raw, idempotencyTTL)
+		}
+	}
+
+	reservationTTL := 10 * time.Minute
+	if raw := os.Getenv("RESERVATION_TTL"); raw != "" {
+		if ttl, err := time.ParseDuration(raw); err == nil && ttl > 0 {
+			reservationTTL = ttl
+		} else {
+			log.Printf("WARNING: invalid RESERVATION_TTL %q, using %s", raw, reservationTTL)
+		}
+	}
+
+	paymentProvider := os.Getenv("PAYMENT_PROVIDER")
+	if paymentProvider == "" {
+		paymentProvider = "fake"
+	}
+
+	// The fake provider signs its own webhooks, so local runs can do
+	// without a secret. A real provider's must be set.
+	webhookSecret := os.Getenv("PAYMENT_WEBHOOK_SECRET")
+	if webhookSecret == "" {
+		if paymentProvider != "fake" {
+			log.Fatal("PAYMENT_WEBHOOK_SECRET is required")
+		}
+		webhookSecret = "fake-webhook-secret"
+		log.Printf("WARNING: PAYMENT_WEBHOOK_SECRET is not set, using a development secret for the fake provider")
+	}
+
+	taxRates, ok := os.LookupEnv("TAX_RATES")
+	if !ok {
+		taxRates = "7"
+	}
+
 	return Config{
-		Port:        port,
-		MongoURL:    mongoURL,
-		MongoDBName: dbName,
+		Port:           port,
+		MongoURL:       mongoURL,
+		MongoDBName:    dbName,
+		IdempotencyTTL: idempotencyTTL,
+		ReservationTTL: reservationTTL,
+
+		PaymentProvider:      paymentProvider,
+		PaymentWebhookSecret: webhookSecret,
+		PaymentFakeOutcomes:  os.Getenv("PAYMENT_FAKE_OUTCOMES"),
+		PaymentWebhookURL:    os.Getenv("PAYMENT_WEBHOOK_URL"),
+
+		ShippingRates: os.Getenv("SHIPPING_RATES"),
+		TaxMode:       os.Getenv("TAX_MODE"),
+		TaxRates:      taxRates,
+
+		GuestMergeCampaigns: os.Getenv("GUEST_MERGE_CAMPAIGNS"),
+		GuestMergePoints:    os.Getenv("GUEST_MERGE_POINTS"),
 	}
 }
@@ -22,6 +22,14 @@ var (
 	TransactionHistoryCollection         *mongo.Collection
 	TransactionHistoryProductCollection  *mongo.Collection
 	TransactionHistoryCampaignCollection *mongo.Collection
+	IdempotencyCollection                *mongo.Collection
+	OrderCollection                      *mongo.Collection
+	RefundCollection                     *mongo.Collection
+	CounterCollection                    *mongo.Collection
+	StockMovementCollection              *mongo.Collection
+	StockReservationCollection           *mongo.Collection
+	AddressCollection                    *mongo.Collection
+	CartCampaignCollection               *mongo.Collection
 )
 
 func ConnectMongo(mongoURL, dbName string) error {
@@ -50,6 +58,11 @@ func ConnectMongo(mongoURL, dbName string) error {
 
 	log.Println("Connect to MongoDB successful")
 
+	TransactionsSupported = supportsTransactions(ctx, client)
+	if !TransactionsSupported {
+		log.Println("WARNING: MongoDB is a standalone server, checkout writes will not run in a transaction")
+	}
+
 	MongoClient = client
 	db := client.Database(dbName)
 	UserCollection = db.Collection("Users")
@@ -62,6 +75,14 @@ func ConnectMongo(mongoURL, dbName string) error {
 	TransactionHistoryCollection = db.Collection("TransactionHistory")
 	TransactionHistoryProductCollection = db.Collection("TransactionHistoryProducts")
 	TransactionHistoryCampaignCollection = db.Collection("TransactionHistoryCampaigns")
+	IdempotencyCollection = db.Collection("IdempotencyKeys")
+	OrderCollection = db.Collection("Orders")
+	RefundCollection = db.Collection("Refunds")
+	CounterCollection = db.Collection("Counters")
+	StockMovementCollection = db.Collection("StockMovements")
+	StockReservationCollection = db.Collection("StockReservations")
+	AddressCollection = db.Collection("Addresses")
+	CartCampaignCollection = db.Collection("CartCampaigns")
 
 	return nil
 }
@@ -0,0 +1,256 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/faiisu/ecom-backend/internal/models"
+	"github.com/faiisu/ecom-backend/internal/money"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// MigrateMoney rewrites money fields that are still stored as float major
+// units (e.g. 89.99) into integer minor units (8999), the format read by
+// money.Money. Only fields holding a BSON double are touched, so it is safe
+// to run on every start.
+func MigrateMoney() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cancel()
+
+	targets := []struct {
+		collection *mongo.Collection
+		fields     []string
+	}{
+		{ProductCollection, []string{"price"}},
+		{CampaignCollection, []string{"discount_value", "limit", "every"}},
+	}
+
+	for _, target := range targets {
+		for _, field := range target.fields {
+			migrated, err := migrateMoneyField(ctx, target.collection, field)
+			if err != nil {
+				return fmt.Errorf("migrate %s.%s: %w", target.collection.Name(), field, err)
+			}
+			if migrated > 0 {
+				log.Printf("Migrated %d %s.%s values to minor units", migrated, target.collection.Name(), field)
+			}
+		}
+	}
+	return nil
+}
+
+func migrateMoneyField(ctx context.Context, collection *mongo.Collection, field string) (int, error) {
+	filter := bson.M{field: bson.M{"$type": "double"}}
+	cursor, err := collection.Find(ctx, filter, options.Find().SetProjection(bson.M{field: 1}))
+	if err != nil {
+		return 0, err
+	}
+	defer cursor.Close(ctx)
+
+	var writes []mongo.WriteModel
+	for cursor.Next(ctx) {
+		var doc bson.M
+		if err := cursor.Decode(&doc); err != nil {
+			return 0, err
+		}
+		value, ok := doc[field].(float64)
+		if !ok {
+			continue
+		}
+		writes = append(writes, mongo.NewUpdateOneModel().
+			SetFilter(bson.M{"_id": doc["_id"], field: bson.M{"$type": "double"}}).
+			SetUpdate(bson.M{"$set": bson.M{field: money.FromFloat(value).Minor()}}))
+	}
+	if err := cursor.Err(); err != nil {
+		return 0, err
+	}
+
+	if len(writes) == 0 {
+		return 0, nil
+	}
+	if _, err := collection.BulkWrite(ctx, writes); err != nil {
+		return 0, err
+	}
+	return len(writes), nil
+}
+
+// MigrateOrders creates an Order for every TransactionHistory row that does
+// not have one yet. Those rows never stored prices or quantities, so items
+// are rebuilt from the current catalog with a quantity of one and the order
+// is flagged as Legacy. Legacy orders are fulfilled, since they were sold
+// before orders existed, and cannot be cancelled or refunded.
+func MigrateOrders() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cancel()
+
+	pipeline := mongo.Pipeline{
+		{{Key: "$lookup", Value: bson.M{
+			"from":         "Orders",
+			"localField":   "_id",
+			"foreignField": "_id",
+			"as":           "order",
+		}}},
+		{{Key: "$match", Value: bson.M{"order": bson.M{"$size": 0}}}},
+		{{Key: "$lookup", Value: bson.M{
+			"from":         "TransactionHistoryProducts",
+			"localField":   "_id",
+			"foreignField": "history_id",
+			"as":           "history_products",
+		}}},
+		{{Key: "$lookup", Value: bson.M{
+			"from":         "Products",
+			"localField":   "history_products.product_id",
+			"foreignField": "_id",
+			"as":           "products",
+		}}},
+		{{Key: "$lookup", Value: bson.M{
+			"from":         "TransactionHistoryCampaigns",
+			"localField":   "_id",
+			"foreignField": "history_id",
+			"as":           "history_campaigns",
+		}}},
+		{{Key: "$lookup", Value: bson.M{
+			"from":         "Campaigns",
+			"localField":   "history_campaigns.campaign_id",
+			"foreignField": "_id",
+			"as":           "campaigns",
+		}}},
+	}
+
+	cursor, err := TransactionHistoryCollection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+
+	var histories []struct {
+		models.TransactionHistory `bson:",inline"`
+		HistoryProducts           []models.TransactionHistoryProduct  `bson:"history_products"`
+		Products                  []models.Product                    `bson:"products"`
+		HistoryCampaigns          []models.TransactionHistoryCampaign `bson:"history_campaigns"`
+		Campaigns                 []models.Campaign                   `bson:"campaigns"`
+	}
+	if err := cursor.All(ctx, &histories); err != nil {
+		return err
+	}
+
+	var orders []interface{}
+	for _, history := range histories {
+		products := make(map[string]models.Product, len(history.Products))
+		for _, product := range history.Products {
+			products[product.ID] = product
+		}
+		campaigns := make(map[string]models.Campaign, len(history.Campaigns))
+		for _, campaign := range history.Campaigns {
+			campaigns[campaign.ID] = campaign
+		}
+
+		order := models.Order{
+			ID:            history.ID,
+			UserID:        history.UserID,
+			Status:        models.OrderFulfilled,
+			Items:         []models.OrderItem{},
+			Campaigns:     []models.OrderCampaign{},
+			PointUsed:     history.PointUsed,
+			PointDiscount: money.FromMajor(int64(history.PointUsed)),
+			Legacy:        true,
+			StatusHistory: []models.OrderStatusChange{
+				{Status: models.OrderPaid, At: history.Date},
+				{Status: models.OrderFulfilled, At: history.Date},
+			},
+			CreatedAt: history.Date,
+			UpdatedAt: history.Date,
+		}
+		for _, row := range history.HistoryProducts {
+			product := products[row.ProductID]
+			order.Items = append(order.Items, models.OrderItem{
+				ProductID:         row.ProductID,
+				ProductName:       product.Name,
+				ProductCategoryID: product.ProductCategoryID,
+				UnitPrice:         product.Price,
+				Quantity:          1,
+				LineTotal:         product.Price,
+				Total:             product.Price,
+			})
+			order.Subtotal += product.Price
+		}
+		for _, row := range history.HistoryCampaigns {
+			campaign := campaigns[row.CampaignID]
+			order.Campaigns = append(order.Campaigns, models.OrderCampaign{
+				CampaignID:    row.CampaignID,
+				Name:          campaign.Name,
+				DiscountType:  campaign.DiscountType,
+				DiscountValue: campaign.DiscountValue,
+			})
+		}
+		order.Discount = money.Min(order.PointDiscount, order.Subtotal)
+		order.Total = order.Subtotal - order.Discount
+		orders = append(orders, order)
+	}
+
+	if len(orders) == 0 {
+		return nil
+	}
+	if _, err := OrderCollection.InsertMany(ctx, orders); err != nil {
+		return err
+	}
+	log.Printf("Migrated %d transaction histories to orders", len(orders))
+	return nil
+}
+
+// MigrateCartItems merges cart lines that share a user and product into one
+// line holding their combined quantity, so the unique index on those fields
+// can be built. Lines were only ever added by read-then-insert before, which
+// let concurrent adds create duplicates. The first line is kept with its
+// price.
+func MigrateCartItems() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cancel()
+
+	pipeline := mongo.Pipeline{
+		{{Key: "$sort", Value: bson.M{"_id": 1}}},
+		{{Key: "$group", Value: bson.M{
+			"_id":      bson.M{"user_id": "$user_id", "product_id": "$product_id"},
+			"ids":      bson.M{"$push": "$_id"},
+			"quantity": bson.M{"$sum": "$quantity"},
+		}}},
+		{{Key: "$match", Value: bson.M{"ids.1": bson.M{"$exists": true}}}},
+	}
+
+	cursor, err := CartCollection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+
+	var groups []struct {
+		IDs      []string `bson:"ids"`
+		Quantity int      `bson:"quantity"`
+	}
+	if err := cursor.All(ctx, &groups); err != nil {
+		return err
+	}
+
+	var writes []mongo.WriteModel
+	for _, group := range groups {
+		writes = append(writes,
+			mongo.NewUpdateOneModel().
+				SetFilter(bson.M{"_id": group.IDs[0]}).
+				SetUpdate(bson.M{"$set": bson.M{"quantity": group.Quantity}}),
+			mongo.NewDeleteManyModel().
+				SetFilter(bson.M{"_id": bson.M{"$in": group.IDs[1:]}}),
+		)
+	}
+	if len(writes) == 0 {
+		return nil
+	}
+	if _, err := CartCollection.BulkWrite(ctx, writes); err != nil {
+		return err
+	}
+	log.Printf("Merged %d duplicated cart lines", len(groups))
+	return nil
+}
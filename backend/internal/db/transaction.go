@@ -0,0 +1,50 @@
+package db
+
+import (
+	"context"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// TransactionsSupported reports whether the connected deployment can run
+// multi-document transactions. It is set by ConnectMongo.
+var TransactionsSupported bool
+
+// WithTransaction runs fn inside a multi-document transaction, retrying it on
+// transient transaction errors and unknown commit results. fn must use the
+// context it is given for every read and write that belongs to the
+// transaction.
+//
+// A standalone server cannot run transactions. There fn runs once with ctx and
+// its writes are applied one by one, so a failure part way through is not
+// rolled back.
+func WithTransaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	if !TransactionsSupported {
+		return fn(ctx)
+	}
+
+	session, err := MongoClient.StartSession()
+	if err != nil {
+		return err
+	}
+	defer session.EndSession(ctx)
+
+	_, err = session.WithTransaction(ctx, func(sessCtx mongo.SessionContext) (interface{}, error) {
+		return nil, fn(sessCtx)
+	})
+	return err
+}
+
+// supportsTransactions asks the server whether it is a replica set member or
+// a mongos router, the two topologies that accept transactions.
+func supportsTransactions(ctx context.Context, client *mongo.Client) bool {
+	var hello struct {
+		SetName string `bson:"setName"`
+		Msg     string `bson:"msg"`
+	}
+	if err := client.Database("admin").RunCommand(ctx, bson.D{{Key: "hello", Value: 1}}).Decode(&hello); err != nil {
+		return false
+	}
+	return hello.SetName != "" || hello.Msg == "isdbgrid"
+}
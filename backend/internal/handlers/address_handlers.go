@@ -0,0 +1,274 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/faiisu/ecom-backend/internal/db"
+	"github.com/faiisu/ecom-backend/internal/models"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// AddressRequest creates an address, or on PATCH changes the fields that
+// are sent.
+type AddressRequest struct {
+	Recipient  *string `json:"recipient,omitempty"`
+	Phone      *string `json:"phone,omitempty"`
+	Line1      *string `json:"line1,omitempty"`
+	Line2      *string `json:"line2,omitempty"`
+	District   *string `json:"district,omitempty"`
+	Province   *string `json:"province,omitempty"`
+	PostalCode *string `json:"postal_code,omitempty"`
+	Country    *string `json:"country,omitempty"`
+	IsDefault  *bool   `json:"is_default,omitempty"`
+}
+
+// apply copies the fields that were sent onto address.
+func (req AddressRequest) apply(address *models.Address) {
+	for _, field := range []struct {
+		from *string
+		to   *string
+	}{
+		{req.Recipient, &address.Recipient},
+		{req.Phone, &address.Phone},
+		{req.Line1, &address.Line1},
+		{req.Line2, &address.Line2},
+		{req.District, &address.District},
+		{req.Province, &address.Province},
+		{req.PostalCode, &address.PostalCode},
+		{req.Country, &address.Country},
+	} {
+		if field.from != nil {
+			*field.to = strings.TrimSpace(*field.from)
+		}
+	}
+	if req.IsDefault != nil {
+		address.IsDefault = *req.IsDefault
+	}
+}
+
+// validateAddress returns what is missing from address, or "".
+func validateAddress(address models.Address) string {
+	if address.Recipient == "" || address.Phone == "" || address.Line1 == "" ||
+		address.Province == "" || address.PostalCode == "" || address.Country == "" {
+		return "recipient, phone, line1, province, postal_code and country are required"
+	}
+	return ""
+}
+
+// GetUserAddresses godoc
+// @Summary List a user's saved addresses
+// @Description The default address comes first, then the rest oldest first.
+// @Tags Addresses
+// @Produce json
+// @Param id path string true "User ID"
+// @Success 200 {array} models.Address
+// @Failure 500 {object} ErrorResponse
+// @Router /users/{id}/addresses [get]
+func GetUserAddresses(c *fiber.Ctx) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	opts := options.Find().SetSort(bson.D{{Key: "is_default", Value: -1}, {Key: "created_at", Value: 1}})
+	cursor, err := db.AddressCollection.Find(ctx, bson.M{"user_id": c.Params("id")}, opts)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{Error: "Failed to fetch addresses"})
+	}
+	defer cursor.Close(ctx)
+
+	addresses := []models.Address{}
+	if err := cursor.All(ctx, &addresses); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{Error: "Failed to decode addresses"})
+	}
+
+	return c.JSON(addresses)
+}
+
+// AddUserAddress godoc
+// @Summary Save an address
+// @Description A user's first address becomes their default. Sending is_default moves the default to the new address.
+// @Tags Addresses
+// @Accept json
+// @Produce json
+// @Param id path string true "User ID"
+// @Param address body AddressRequest true "Address"
+// @Success 201 {object} models.Address
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /users/{id}/addresses [post]
+func AddUserAddress(c *fiber.Ctx) error {
+	userID := c.Params("id")
+	var req AddressRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Error: "Invalid request body"})
+	}
+
+	address := models.Address{
+		ID:        uuid.New().String(),
+		UserID:    userID,
+		CreatedAt: time.Now(),
+	}
+	req.apply(&address)
+	if msg := validateAddress(address); msg != "" {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Error: msg})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	err := db.WithTransaction(ctx, func(txCtx context.Context) error {
+		err := db.UserCollection.FindOne(txCtx, bson.M{"_id": userID}).Err()
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return fiber.NewError(fiber.StatusNotFound, "User not found")
+		}
+		if err != nil {
+			return &commitError{message: "Failed to fetch user", err: err}
+		}
+
+		count, err := db.AddressCollection.CountDocuments(txCtx, bson.M{"user_id": userID})
+		if err != nil {
+			return &commitError{message: "Failed to fetch addresses", err: err}
+		}
+		if count == 0 {
+			address.IsDefault = true
+		}
+		if address.IsDefault {
+			if err := clearDefaultAddress(txCtx, userID); err != nil {
+				return err
+			}
+		}
+
+		if _, err := db.AddressCollection.InsertOne(txCtx, address); err != nil {
+			return &commitError{message: "Failed to save address", err: err}
+		}
+		return nil
+	})
+	if err != nil {
+		return respondError(c, err)
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(address)
+}
+
+// UpdateUserAddress godoc
+// @Summary Change a saved address
+// @Description Only the fields that are sent change. Setting is_default makes this the user's default; the default cannot be unset, pick another address instead. Orders keep the address they were placed with.
+// @Tags Addresses
+// @Accept json
+// @Produce json
+// @Param id path string true "User ID"
+// @Param address_id path string true "Address ID"
+// @Param address body AddressRequest true "Fields to change"
+// @Success 200 {object} models.Address
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /users/{id}/addresses/{address_id} [patch]
+func UpdateUserAddress(c *fiber.Ctx) error {
+	userID := c.Params("id")
+	filter := bson.M{"_id": c.Params("address_id"), "user_id": userID}
+	var req AddressRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Error: "Invalid request body"})
+	}
+	if req.IsDefault != nil && !*req.IsDefault {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Error: "Choose another default address instead"})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var address models.Address
+	err := db.WithTransaction(ctx, func(txCtx context.Context) error {
+		err := db.AddressCollection.FindOne(txCtx, filter).Decode(&address)
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return fiber.NewError(fiber.StatusNotFound, "Address not found")
+		}
+		if err != nil {
+			return &commitError{message: "Failed to fetch address", err: err}
+		}
+
+		wasDefault := address.IsDefault
+		req.apply(&address)
+		if msg := validateAddress(address); msg != "" {
+			return fiber.NewError(fiber.StatusBadRequest, msg)
+		}
+		if address.IsDefault && !wasDefault {
+			if err := clearDefaultAddress(txCtx, userID); err != nil {
+				return err
+			}
+		}
+
+		if _, err := db.AddressCollection.ReplaceOne(txCtx, filter, address); err != nil {
+			return &commitError{message: "Failed to update address", err: err}
+		}
+		return nil
+	})
+	if err != nil {
+		return respondError(c, err)
+	}
+
+	return c.JSON(address)
+}
+
+// DeleteUserAddress godoc
+// @Summary Delete a saved address
+// @Description When the default is deleted, the oldest remaining address becomes the default.
+// @Tags Addresses
+// @Produce json
+// @Param id path string true "User ID"
+// @Param address_id path string true "Address ID"
+// @Success 200 {object} map[string]string
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /users/{id}/addresses/{address_id} [delete]
+func DeleteUserAddress(c *fiber.Ctx) error {
+	userID := c.Params("id")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	err := db.WithTransaction(ctx, func(txCtx context.Context) error {
+		var address models.Address
+		filter := bson.M{"_id": c.Params("address_id"), "user_id": userID}
+		err := db.AddressCollection.FindOneAndDelete(txCtx, filter).Decode(&address)
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return fiber.NewError(fiber.StatusNotFound, "Address not found")
+		}
+		if err != nil {
+			return &commitError{message: "Failed to delete address", err: err}
+		}
+		if !address.IsDefault {
+			return nil
+		}
+
+		opts := options.FindOneAndUpdate().SetSort(bson.D{{Key: "created_at", Value: 1}})
+		update := bson.M{"$set": bson.M{"is_default": true}}
+		err = db.AddressCollection.FindOneAndUpdate(txCtx, bson.M{"user_id": userID}, update, opts).Err()
+		if err != nil && !errors.Is(err, mongo.ErrNoDocuments) {
+			return &commitError{message: "Failed to set default address", err: err}
+		}
+		return nil
+	})
+	if err != nil {
+		return respondError(c, err)
+	}
+
+	return c.JSON(fiber.Map{"message": "Address deleted"})
+}
+
+// clearDefaultAddress unsets the user's current default address.
+func clearDefaultAddress(ctx context.Context, userID string) error {
+	filter := bson.M{"user_id": userID, "is_default": true}
+	if _, err := db.AddressCollection.UpdateMany(ctx, filter, bson.M{"$set": bson.M{"is_default": false}}); err != nil {
+		return &commitError{message: "Failed to update default address", err: err}
+	}
+	return nil
+}
@@ -7,6 +7,8 @@ import (
 
 	"github.com/faiisu/ecom-backend/internal/db"
 	"github.com/faiisu/ecom-backend/internal/models"
+	"github.com/faiisu/ecom-backend/internal/money"
+	"github.com/faiisu/ecom-backend/internal/pricing"
 	"github.com/gofiber/fiber/v2"
 	"github.com/google/uuid"
 	"go.mongodb.org/mongo-driver/bson"
@@ -15,21 +17,23 @@ import (
 )
 
 type RegisterCampaign struct {
-	Name                  string   `json:"name"`
-	Description           string   `json:"description"`
-	DiscountType          string   `json:"discount_type"`
-	DiscountValue         float64  `json:"discount_value"`
-	Limit                 float64  `json:"limit"`
-	Every                 float64  `json:"every"`
-	CampaignCategoryID    string   `json:"campaign_category_id"`
-	IsActive              bool     `json:"is_active"`
-	ListProductCategoryID []string `json:"list_product_category_id"`
+	Name                  string      `json:"name"`
+	Description           string      `json:"description"`
+	DiscountType          string      `json:"discount_type"`
+	DiscountValue         money.Money `json:"discount_value"`
+	Limit                 money.Money `json:"limit"`
+	Every                 money.Money `json:"every"`
+	CampaignCategoryID    string      `json:"campaign_category_id"`
+	IsActive              bool        `json:"is_active"`
+	ListProductCategoryID []string    `json:"list_product_category_id"`
+	ShippingScope         string      `json:"shipping_scope"` // "include" or "only" to discount the shipping fee
 }
 
 type RegisterCampaignCategory struct {
-	Name        string `json:"name"`
-	Description string `json:"description"`
-	Rank        int    `json:"rank"`
+	Name          string `json:"name" bson:"name"`
+	Description   string `json:"description" bson:"description"`
+	Rank          int    `json:"rank" bson:"rank"`
+	AllowMultiple bool   `json:"allow_multiple" bson:"allow_multiple"`
 }
 
 // AddCampaign godoc
@@ -50,6 +54,9 @@ func AddCampaign(c *fiber.Ctx) error {
 	if req.Name == "" || req.DiscountType == "" {
 		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Error: "Missing required fields"})
 	}
+	if req.ShippingScope != "" && req.ShippingScope != pricing.ShippingInclude && req.ShippingScope != pricing.ShippingOnly {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Error: "shipping_scope must be include or only"})
+	}
 
 	campaign := models.Campaign{
 		ID:                 uuid.New().String(),
@@ -61,6 +68,7 @@ func AddCampaign(c *fiber.Ctx) error {
 		Every:              req.Every,
 		CampaignCategoryID: req.CampaignCategoryID,
 		IsActive:           req.IsActive,
+		ShippingScope:      req.ShippingScope,
 	}
 
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
@@ -317,3 +325,55 @@ func RealignCampaignCategoryRanks(c *fiber.Ctx) error {
 
 	return c.JSON(fiber.Map{"status": "Ranks updated successfully"})
 }
+
+type CampaignCategoryExclusivityRequest struct {
+	AllowMultiple bool `json:"allow_multiple"`
+}
+
+// UpdateCampaignCategoryExclusivity godoc
+// @Summary Set whether a campaign category allows multiple campaigns
+// @Description When allow_multiple is false, checkout rejects carts that select more than one campaign from this category
+// @Tags Campaigns
+// @Accept json
+// @Produce json
+// @Param id path string true "Campaign category ID"
+// @Param body body CampaignCategoryExclusivityRequest true "Exclusivity setting"
+// @Success 200 {object} map[string]string
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /campaign-categories/{id}/exclusivity [patch]
+func UpdateCampaignCategoryExclusivity(c *fiber.Ctx) error {
+	id := c.Params("id")
+	if id == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Error: "Category ID is required"})
+	}
+
+	var req CampaignCategoryExclusivityRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Error: "Invalid request body"})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// Categories created through AddCampaignCategory are keyed by ObjectID
+	var filter bson.M
+	if objID, err := primitive.ObjectIDFromHex(id); err == nil {
+		filter = bson.M{"_id": objID}
+	} else {
+		filter = bson.M{"_id": id}
+	}
+
+	update := bson.M{"$set": bson.M{"allow_multiple": req.AllowMultiple}}
+	result, err := db.CampaignCategoryCollection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{Error: "Failed to update category"})
+	}
+
+	if result.MatchedCount == 0 {
+		return c.Status(fiber.StatusNotFound).JSON(ErrorResponse{Error: "Category not found"})
+	}
+
+	return c.JSON(fiber.Map{"status": "Category updated successfully"})
+}
@@ -0,0 +1,188 @@
+package handlers
+
+import (
+	"context"
+	"time"
+
+	"github.com/faiisu/ecom-backend/internal/db"
+	"github.com/faiisu/ecom-backend/internal/models"
+	"github.com/faiisu/ecom-backend/internal/pricing"
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type AttachCartCampaignRequest struct {
+	CampaignID string `json:"campaign_id"`
+}
+
+// GetCartCampaigns godoc
+// @Summary List the campaigns attached to a cart
+// @Description In the order they were attached. A campaign deactivated since then is still listed, and checkout rejects it.
+// @Tags Cart
+// @Produce json
+// @Param user_id path string true "User ID"
+// @Success 200 {array} models.Campaign
+// @Failure 500 {object} ErrorResponse
+// @Router /cart/{user_id}/campaigns [get]
+func GetCartCampaigns(c *fiber.Ctx) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	campaigns, err := attachedCampaigns(ctx, c.Params("user_id"))
+	if err != nil {
+		return respondError(c, err)
+	}
+	return c.JSON(campaigns)
+}
+
+// AttachCartCampaign godoc
+// @Summary Attach a campaign to a cart
+// @Description The campaign must exist and be active, and must not share an exclusive campaign category with a campaign already attached. Attaching it again changes nothing. Checkout uses the attached campaigns unless campaign_ids is sent.
+// @Tags Cart
+// @Accept json
+// @Produce json
+// @Param user_id path string true "User ID"
+// @Param campaign body AttachCartCampaignRequest true "Campaign to attach"
+// @Success 200 {array} models.Campaign
+// @Failure 400 {object} CampaignConflictResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /cart/{user_id}/campaigns [post]
+func AttachCartCampaign(c *fiber.Ctx) error {
+	userID := c.Params("user_id")
+	var req AttachCartCampaignRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Error: "Invalid request body"})
+	}
+	if req.CampaignID == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Error: "campaign_id is required"})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	found, err := findCampaigns(ctx, []string{req.CampaignID})
+	if err != nil {
+		return respondError(c, err)
+	}
+	if len(found) == 0 {
+		return c.Status(fiber.StatusNotFound).JSON(ErrorResponse{Error: "Campaign not found"})
+	}
+	if !found[0].IsActive {
+		return c.Status(fiber.StatusConflict).JSON(ErrorResponse{Error: "Campaign is not active"})
+	}
+
+	attached, err := attachedCampaigns(ctx, userID)
+	if err != nil {
+		return respondError(c, err)
+	}
+	selection := []models.Campaign{found[0]}
+	for _, campaign := range attached {
+		if campaign.ID == req.CampaignID {
+			return c.JSON(attached)
+		}
+		if campaign.IsActive {
+			selection = append(selection, campaign)
+		}
+	}
+	categories, err := findCampaignCategories(ctx, selection)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{Error: "Failed to fetch campaign categories"})
+	}
+	if conflicts := pricing.FindConflicts(selection, categories); len(conflicts) > 0 {
+		return respondError(c, &pricing.ConflictError{Conflicts: conflicts})
+	}
+
+	filter := bson.M{"user_id": userID, "campaign_id": req.CampaignID}
+	update := bson.M{"$setOnInsert": bson.M{"attached_at": time.Now()}}
+	if _, err := db.CartCampaignCollection.UpdateOne(ctx, filter, update, options.Update().SetUpsert(true)); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{Error: "Failed to attach campaign"})
+	}
+
+	return c.JSON(append(attached, found[0]))
+}
+
+// DetachCartCampaign godoc
+// @Summary Detach a campaign from a cart
+// @Tags Cart
+// @Produce json
+// @Param user_id path string true "User ID"
+// @Param campaign_id path string true "Campaign ID"
+// @Success 200 {array} models.Campaign
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /cart/{user_id}/campaigns/{campaign_id} [delete]
+func DetachCartCampaign(c *fiber.Ctx) error {
+	userID := c.Params("user_id")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	filter := bson.M{"user_id": userID, "campaign_id": c.Params("campaign_id")}
+	result, err := db.CartCampaignCollection.DeleteOne(ctx, filter)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{Error: "Failed to detach campaign"})
+	}
+	if result.DeletedCount == 0 {
+		return c.Status(fiber.StatusNotFound).JSON(ErrorResponse{Error: "Campaign is not attached to the cart"})
+	}
+
+	campaigns, err := attachedCampaigns(ctx, userID)
+	if err != nil {
+		return respondError(c, err)
+	}
+	return c.JSON(campaigns)
+}
+
+// cartCampaignIDs returns the IDs of the campaigns attached to the user's
+// cart, in the order they were attached. It never returns nil, so the
+// result reads as a selection even when nothing is attached.
+func cartCampaignIDs(ctx context.Context, userID string) ([]string, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "attached_at", Value: 1}})
+	cursor, err := db.CartCampaignCollection.Find(ctx, bson.M{"user_id": userID}, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var rows []models.CartCampaign
+	if err := cursor.All(ctx, &rows); err != nil {
+		return nil, err
+	}
+	ids := make([]string, 0, len(rows))
+	for _, row := range rows {
+		ids = append(ids, row.CampaignID)
+	}
+	return ids, nil
+}
+
+// attachedCampaigns returns the campaigns attached to the user's cart, in
+// the order they were attached, with their target categories. Campaigns
+// that no longer exist are left out. Errors are returned as *fiber.Error.
+func attachedCampaigns(ctx context.Context, userID string) ([]models.Campaign, error) {
+	ids, err := cartCampaignIDs(ctx, userID)
+	if err != nil {
+		return nil, fiber.NewError(fiber.StatusInternalServerError, "Failed to fetch cart campaigns")
+	}
+	found, err := findCampaigns(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+
+	byID := make(map[string]models.Campaign, len(found))
+	for _, campaign := range found {
+		if campaign.ProductCategories == nil {
+			campaign.ProductCategories = []models.ProductCategory{}
+		}
+		byID[campaign.ID] = campaign
+	}
+	campaigns := make([]models.Campaign, 0, len(ids))
+	for _, id := range ids {
+		if campaign, ok := byID[id]; ok {
+			campaigns = append(campaigns, campaign)
+		}
+	}
+	return campaigns, nil
+}
@@ -2,14 +2,19 @@ package handlers
 
 import (
 	"context"
+	"errors"
+	"strconv"
 	"time"
 
 	"github.com/faiisu/ecom-backend/internal/db"
 	"github.com/faiisu/ecom-backend/internal/models"
+	"github.com/faiisu/ecom-backend/internal/money"
+	"github.com/faiisu/ecom-backend/internal/pricing"
 	"github.com/gofiber/fiber/v2"
 	"github.com/google/uuid"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 type AddCartItemRequest struct {
@@ -20,13 +25,15 @@ type AddCartItemRequest struct {
 
 // AddCartItem godoc
 // @Summary Add item to cart
-// @Description Adds a product to the user's cart or updates quantity if it already exists
+// @Description Adds a product to the user's cart or updates quantity if it already exists. The product's current price is kept on the line so checkout can tell if it changes.
 // @Tags Cart
 // @Accept json
 // @Produce json
 // @Param cartItem body AddCartItemRequest true "Cart Item payload"
 // @Success 200 {object} models.CartItem
 // @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
 // @Failure 500 {object} ErrorResponse
 // @Router /cart [post]
 func AddCartItem(c *fiber.Ctx) error {
@@ -42,6 +49,18 @@ func AddCartItem(c *fiber.Ctx) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
+	var product models.Product
+	err := db.ProductCollection.FindOne(ctx, bson.M{"_id": req.ProductID}).Decode(&product)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return c.Status(fiber.StatusNotFound).JSON(ErrorResponse{Error: "Product not found"})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{Error: "Failed to fetch product"})
+	}
+	if !product.IsActive {
+		return c.Status(fiber.StatusConflict).JSON(ErrorResponse{Error: "Product is not available"})
+	}
+
 	// Check if item exists in cart
 	filter := bson.M{
 		"user_id":    req.UserID,
@@ -49,47 +68,150 @@ func AddCartItem(c *fiber.Ctx) error {
 	}
 
 	var existingItem models.CartItem
-	err := db.CartCollection.FindOne(ctx, filter).Decode(&existingItem)
+	err = db.CartCollection.FindOne(ctx, filter).Decode(&existingItem)
 
-	if err == nil {
-		// Item exists, update quantity
-		update := bson.M{
-			"$inc": bson.M{"quantity": req.Quantity},
-		}
-		_, err := db.CartCollection.UpdateOne(ctx, filter, update)
-		if err != nil {
-			return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{Error: "Failed to update cart item"})
-		}
-		existingItem.Quantity += req.Quantity
-		return c.JSON(existingItem)
-	} else if err != mongo.ErrNoDocuments {
+	if err != nil && !errors.Is(err, mongo.ErrNoDocuments) {
 		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{Error: "Failed to check cart"})
 	}
-
-	// Item does not exist, insert new
-	newItem := models.CartItem{
-		ID:        uuid.New().String(),
-		UserID:    req.UserID,
-		ProductID: req.ProductID,
-		Quantity:  req.Quantity,
+	if product.Stock != nil && existingItem.Quantity+req.Quantity > *product.Stock {
+		return c.Status(fiber.StatusConflict).JSON(ErrorResponse{Error: "Only " + strconv.Itoa(*product.Stock) + " left in stock"})
 	}
 
-	_, err = db.CartCollection.InsertOne(ctx, newItem)
+	// Add to the line, creating it if needed, and keep the price the
+	// customer now sees
+	update := bson.M{
+		"$inc":         bson.M{"quantity": req.Quantity},
+		"$set":         bson.M{"unit_price": product.Price},
+		"$setOnInsert": bson.M{"_id": uuid.New().String()},
+	}
+	item, err := upsertCartItem(ctx, filter, update)
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{Error: "Failed to add item to cart"})
 	}
 
-	return c.JSON(newItem)
+	return c.JSON(item)
+}
+
+type SetCartItemRequest struct {
+	UserID    string `json:"user_id"`
+	ProductID string `json:"product_id"`
+	Quantity  int    `json:"quantity"` // 0 removes the line
+}
+
+// SetCartItem godoc
+// @Summary Set the quantity of a cart item
+// @Description Sets a product's quantity in the user's cart, adding the line if it is missing. Quantity 0 removes the line, and removing a line that is not there succeeds. The product must exist, be active and have the stock; the line takes its current price.
+// @Tags Cart
+// @Accept json
+// @Produce json
+// @Param cartItem body SetCartItemRequest true "Cart Item payload"
+// @Success 200 {object} models.CartItem
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /cart [patch]
+func SetCartItem(c *fiber.Ctx) error {
+	var req SetCartItemRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Error: "Invalid request body"})
+	}
+
+	if req.UserID == "" || req.ProductID == "" || req.Quantity < 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Error: "Invalid input: user_id, product_id, and quantity >= 0 are required"})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	filter := bson.M{
+		"user_id":    req.UserID,
+		"product_id": req.ProductID,
+	}
+
+	if req.Quantity == 0 {
+		if _, err := db.CartCollection.DeleteOne(ctx, filter); err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{Error: "Failed to delete cart item"})
+		}
+		return c.JSON(fiber.Map{"message": "Item removed from cart"})
+	}
+
+	var product models.Product
+	err := db.ProductCollection.FindOne(ctx, bson.M{"_id": req.ProductID}).Decode(&product)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return c.Status(fiber.StatusNotFound).JSON(ErrorResponse{Error: "Product not found"})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{Error: "Failed to fetch product"})
+	}
+	if !product.IsActive {
+		return c.Status(fiber.StatusConflict).JSON(ErrorResponse{Error: "Product is not available"})
+	}
+	if product.Stock != nil && req.Quantity > *product.Stock {
+		return c.Status(fiber.StatusConflict).JSON(ErrorResponse{Error: "Only " + strconv.Itoa(*product.Stock) + " left in stock"})
+	}
+
+	update := bson.M{
+		"$set":         bson.M{"quantity": req.Quantity, "unit_price": product.Price},
+		"$setOnInsert": bson.M{"_id": uuid.New().String()},
+	}
+	item, err := upsertCartItem(ctx, filter, update)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{Error: "Failed to update cart item"})
+	}
+
+	return c.JSON(item)
+}
+
+// upsertCartItem applies update to the cart line matching filter, creating
+// it if there is none, and returns the line as updated. The unique index on
+// user_id and product_id keeps concurrent upserts from creating two lines.
+func upsertCartItem(ctx context.Context, filter, update bson.M) (models.CartItem, error) {
+	opts := options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)
+	var item models.CartItem
+	err := db.CartCollection.FindOneAndUpdate(ctx, filter, update, opts).Decode(&item)
+	return item, err
+}
+
+// CartItemResponse is a cart line as it stands against the catalog.
+// ProductPrice is the current price and CartPrice the price when the line
+// was last added or set. Unavailable lines are not in the subtotal.
+type CartItemResponse struct {
+	ID                  string      `json:"id"`
+	ProductID           string      `json:"product_id"`
+	ProductName         string      `json:"product_name"`
+	ProductCategoryID   string      `json:"product_category_id"`
+	ProductCategoryName string      `json:"product_category_name"`
+	Quantity            int         `json:"quantity"`
+	ProductPrice        money.Money `json:"product_price"`
+	CartPrice           money.Money `json:"cart_price"`
+	LineTotal           money.Money `json:"line_total"`
+	Available           bool        `json:"available"`
+}
+
+// CartResponse is a cart with its totals. Preview is the cart priced the way
+// checkout would price it with the attached campaigns, before shipping; it
+// is null when nothing in the cart can be bought. Attached campaigns that
+// clash in an exclusive category are listed in Conflicts and left out of
+// the preview.
+type CartResponse struct {
+	Items     []CartItemResponse         `json:"items"`
+	ItemCount int                        `json:"item_count"`
+	Subtotal  money.Money                `json:"subtotal"`
+	Campaigns []models.Campaign          `json:"campaigns"` // attached to the cart, used by checkout by default
+	Preview   *pricing.Quote             `json:"preview"`
+	Conflicts []pricing.CampaignConflict `json:"conflicts,omitempty"`
+	Warnings  []CartIssue                `json:"warnings"`
 }
 
 // GetCartItems godoc
-// @Summary Get cart items for a user
-// @Description Retrieve all items in a user's cart with product details
+// @Summary Get a user's cart
+// @Description Returns the cart lines with their current prices and line totals, the subtotal and item count of what can be bought, the attached campaigns and a preview of the discounted total from the checkout pricing engine. Missing and inactive products and changed prices are listed in warnings.
 // @Tags Cart
 // @Accept json
 // @Produce json
 // @Param user_id path string true "User ID"
-// @Success 200 {array} map[string]interface{}
+// @Success 200 {object} CartResponse
 // @Failure 500 {object} ErrorResponse
 // @Router /cart/{user_id} [get]
 func GetCartItems(c *fiber.Ctx) error {
@@ -97,6 +219,97 @@ func GetCartItems(c *fiber.Ctx) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
+	entries, lines, issues, err := loadCart(ctx, userID)
+	if err != nil {
+		return respondError(c, err)
+	}
+	campaigns, err := attachedCampaigns(ctx, userID)
+	if err != nil {
+		return respondError(c, err)
+	}
+
+	resp := CartResponse{
+		Items:     make([]CartItemResponse, 0, len(entries)),
+		Campaigns: campaigns,
+		Warnings:  issues,
+	}
+	unavailable := make(map[string]bool)
+	for _, issue := range issues {
+		if issue.Issue != IssuePriceChanged {
+			unavailable[issue.ProductID] = true
+		}
+	}
+	for _, entry := range entries {
+		item := CartItemResponse{
+			ID:                  entry.ID,
+			ProductID:           entry.ProductID,
+			ProductName:         entry.Product.Name,
+			ProductCategoryID:   entry.Product.ProductCategoryID,
+			ProductCategoryName: entry.Product.ProductCategoryName,
+			Quantity:            entry.Quantity,
+			ProductPrice:        entry.Product.Price,
+			CartPrice:           entry.UnitPrice,
+			LineTotal:           entry.Product.Price.Mul(int64(entry.Quantity)),
+			Available:           !unavailable[entry.ProductID],
+		}
+		if item.Available {
+			resp.ItemCount += item.Quantity
+			resp.Subtotal += item.LineTotal
+		}
+		resp.Items = append(resp.Items, item)
+	}
+	if len(lines) == 0 {
+		return c.JSON(resp)
+	}
+
+	// Price it as checkout would, leaving out campaigns that cannot go together
+	var user models.User
+	err = db.UserCollection.FindOne(ctx, bson.M{"_id": userID}).Decode(&user)
+	if err != nil && !errors.Is(err, mongo.ErrNoDocuments) {
+		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{Error: "Failed to fetch user"})
+	}
+	categories, err := findCampaignCategories(ctx, campaigns)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{Error: "Failed to fetch campaign categories"})
+	}
+	in := pricing.Input{
+		Lines:      lines,
+		User:       user,
+		Campaigns:  campaigns,
+		Categories: categories,
+		Tax:        Taxes,
+	}
+	quote, err := pricing.Calculate(in)
+	var conflictErr *pricing.ConflictError
+	if errors.As(err, &conflictErr) {
+		resp.Conflicts = conflictErr.Conflicts
+		in.Campaigns = nil
+		quote, err = pricing.Calculate(in)
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{Error: "Failed to price cart"})
+	}
+	resp.Preview = &quote
+
+	return c.JSON(resp)
+}
+
+// cartEntry is a cart line with its product as it is now. Product.ID is
+// empty when the product no longer exists.
+type cartEntry struct {
+	ID        string         `bson:"_id"`
+	ProductID string         `bson:"product_id"`
+	Quantity  int            `bson:"quantity"`
+	UnitPrice money.Money    `bson:"unit_price"`
+	Product   models.Product `bson:"product"`
+}
+
+// loadCart returns the user's cart lines, the pricing lines for those that
+// can be bought and the issues found with the rest. Lines whose product is
+// missing, inactive or short of stock are left out of the pricing lines; lines whose price
+// changed since they were added stay in and are reported too. Errors are
+// returned as *fiber.Error.
+func loadCart(ctx context.Context, userID string) ([]cartEntry, []pricing.Line, []CartIssue, error) {
 	pipeline := mongo.Pipeline{
 		{{Key: "$match", Value: bson.M{"user_id": userID}}},
 		{{Key: "$lookup", Value: bson.M{
@@ -109,32 +322,69 @@ func GetCartItems(c *fiber.Ctx) error {
 			"path":                       "$product",
 			"preserveNullAndEmptyArrays": true,
 		}}},
-		{{Key: "$project", Value: bson.M{
-			"id":            "$_id",
-			"product_id":    1,
-			"quantity":      1,
-			"product_name":  "$product.name",
-			"product_price": "$product.price",
+		{{Key: "$lookup", Value: bson.M{
+			"from":         "ProductCategories",
+			"localField":   "product.product_category_id",
+			"foreignField": "_id",
+			"as":           "category",
+		}}},
+		{{Key: "$unwind", Value: bson.M{
+			"path":                       "$category",
+			"preserveNullAndEmptyArrays": true,
+		}}},
+		{{Key: "$addFields", Value: bson.M{
+			"product.product_category_name": "$category.name",
+			// products created before is_active existed are active
+			"product.is_active": bson.M{"$ifNull": bson.A{"$product.is_active", true}},
 		}}},
 	}
 
 	cursor, err := db.CartCollection.Aggregate(ctx, pipeline)
 	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{Error: "Failed to fetch cart items"})
+		return nil, nil, nil, fiber.NewError(fiber.StatusInternalServerError, "Failed to fetch cart items")
 	}
 	defer cursor.Close(ctx)
 
-	var results []bson.M
-	if err = cursor.All(ctx, &results); err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{Error: "Failed to decode cart items"})
+	entries := []cartEntry{}
+	if err = cursor.All(ctx, &entries); err != nil {
+		return nil, nil, nil, fiber.NewError(fiber.StatusInternalServerError, "Failed to decode cart items")
 	}
 
-	// Ensure empty list instead of null
-	if results == nil {
-		results = []bson.M{}
+	held, err := reservedStock(ctx, userID)
+	if err != nil {
+		return nil, nil, nil, fiber.NewError(fiber.StatusInternalServerError, "Failed to fetch reservations")
 	}
 
-	return c.JSON(results)
+	lines := make([]pricing.Line, 0, len(entries))
+	issues := []CartIssue{}
+	for _, entry := range entries {
+		issue := CartIssue{ProductID: entry.ProductID, ProductName: entry.Product.Name, Quantity: entry.Quantity}
+		switch {
+		case entry.Product.ID == "":
+			issue.Issue = IssueProductMissing
+			issues = append(issues, issue)
+			continue
+		case !entry.Product.IsActive:
+			issue.Issue = IssueProductInactive
+			issues = append(issues, issue)
+			continue
+		case entry.Product.Stock != nil && entry.Quantity > *entry.Product.Stock+held[entry.ProductID]:
+			// the user's own reservation is already off the stock level
+			inStock := *entry.Product.Stock + held[entry.ProductID]
+			issue.Issue = IssueOutOfStock
+			issue.InStock = &inStock
+			issues = append(issues, issue)
+			continue
+		case entry.UnitPrice != 0 && entry.UnitPrice != entry.Product.Price:
+			// lines added before prices were kept on the cart have none to compare
+			issue.Issue = IssuePriceChanged
+			issue.CartPrice = entry.UnitPrice
+			issue.CurrentPrice = entry.Product.Price
+			issues = append(issues, issue)
+		}
+		lines = append(lines, pricing.Line{Product: entry.Product, Quantity: entry.Quantity})
+	}
+	return entries, lines, issues, nil
 }
 
 type DeleteCartItemRequest struct {
@@ -2,202 +2,676 @@ package handlers
 
 import (
 	"context"
-	"math"
+	"errors"
+	"log"
 	"time"
 
 	"github.com/faiisu/ecom-backend/internal/db"
 	"github.com/faiisu/ecom-backend/internal/models"
+	"github.com/faiisu/ecom-backend/internal/money"
+	"github.com/faiisu/ecom-backend/internal/payment"
+	"github.com/faiisu/ecom-backend/internal/pricing"
+	"github.com/faiisu/ecom-backend/internal/shipping"
+	"github.com/faiisu/ecom-backend/internal/tax"
 	"github.com/gofiber/fiber/v2"
 	"github.com/google/uuid"
 	"go.mongodb.org/mongo-driver/bson"
-	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
+// Shipping prices delivery at checkout. It is set from config at startup.
+var Shipping shipping.Calculator = shipping.Free{}
+
+// Taxes holds the tax rates charged at checkout. It is set from config at
+// startup.
+var Taxes = tax.Table{Mode: tax.Inclusive, Default: money.FromMajor(7)}
+
 type CheckoutRequest struct {
-	UserID      string   `json:"user_id"`
-	CampaignIDs []string `json:"campaign_ids"`
-	PointUsed   int      `json:"point_used"`
+	UserID        string       `json:"user_id"`
+	CampaignIDs   []string     `json:"campaign_ids,omitempty"`   // leave out to use the campaigns attached to the cart, [] for none
+	AddressID     string       `json:"address_id,omitempty"`     // one of the user's saved addresses; without it nothing is shipped
+	PointUsed     int          `json:"point_used"`               // most points to redeem through point campaigns, 0 for no limit
+	ExpectedTotal *money.Money `json:"expected_total,omitempty"` // the total the customer was shown; checkout fails if it changed
 }
 
 type CheckoutResponse struct {
-	TotalPrice float64 `json:"total_price"`
-	Message    string  `json:"message"`
+	TotalPrice        money.Money                `json:"total_price"`
+	Subtotal          money.Money                `json:"subtotal"`
+	Shipping          pricing.ShippingLine       `json:"shipping"`
+	Lines             []pricing.QuoteLine        `json:"lines"`
+	Campaigns         []pricing.CampaignDiscount `json:"campaigns"`
+	RejectedCampaigns []pricing.RejectedCampaign `json:"rejected_campaigns"`
+	PointUsed         int                        `json:"point_used"`
+	PointDiscount     money.Money                `json:"point_discount"`
+	TaxMode           string                     `json:"tax_mode"`
+	Tax               money.Money                `json:"tax"`
+	OrderID           string                     `json:"order_id"`
+	OrderStatus       string                     `json:"order_status"`
+	Issues            []CartIssue                `json:"issues"`
+	Message           string                     `json:"message"`
+}
+
+type CampaignConflictResponse struct {
+	Error     string                     `json:"error"`
+	Conflicts []pricing.CampaignConflict `json:"conflicts"`
+}
+
+// Problems found with cart lines while pricing a checkout.
+const (
+	IssueProductMissing  = "product_missing"  // the product was deleted; the line is left out
+	IssueProductInactive = "product_inactive" // the product is deactivated; the line is left out
+	IssueOutOfStock      = "out_of_stock"     // more than is left in stock; the line is left out
+	IssuePriceChanged    = "price_changed"    // the price differs from when the line was added
+)
+
+// CartIssue is a cart line that cannot be bought as the customer saw it.
+// Prices are only set for price changes and InStock for a shortage.
+type CartIssue struct {
+	ProductID    string      `json:"product_id"`
+	ProductName  string      `json:"product_name,omitempty"`
+	Quantity     int         `json:"quantity"`
+	Issue        string      `json:"issue"`
+	CartPrice    money.Money `json:"cart_price,omitempty"`
+	CurrentPrice money.Money `json:"current_price,omitempty"`
+	InStock      *int        `json:"in_stock,omitempty"` // what the user can still buy, counting their reservation
+}
+
+// CheckoutPreviewResponse is the quote for the available lines, with the
+// issues found in the rest of the cart.
+type CheckoutPreviewResponse struct {
+	pricing.Quote
+	Issues          []CartIssue     `json:"issues"`
+	ShippingAddress *models.Address `json:"shipping_address,omitempty"`
+}
+
+// CartIssuesResponse is a checkout refused because of its cart. For a total
+// that no longer matches, ExpectedTotal and TotalPrice show the difference.
+type CartIssuesResponse struct {
+	Error             string                     `json:"error"`
+	Issues            []CartIssue                `json:"issues"`
+	ExpectedTotal     *money.Money               `json:"expected_total,omitempty"`
+	TotalPrice        *money.Money               `json:"total_price,omitempty"`
+	RejectedCampaigns []pricing.RejectedCampaign `json:"rejected_campaigns,omitempty"`
+}
+
+// cartIssuesError carries a CartIssuesResponse to respondError.
+type cartIssuesError struct {
+	resp CartIssuesResponse
+}
+
+func (e *cartIssuesError) Error() string { return e.resp.Error }
+
+// checkoutQuote is a priced cart with what was found while pricing it.
+type checkoutQuote struct {
+	pricing.Quote
+	Issues  []CartIssue
+	Address *models.Address // nil when nothing is shipped
+}
+
+// quoteCheckout loads the user's cart, profile, shipping address and
+// selected campaigns and prices them. Without CampaignIDs the campaigns
+// attached to the cart are used. Lines loadCart finds unavailable are left
+// out of the quote and reported as issues. Errors are returned as
+// *fiber.Error so callers can relay the status and message unchanged.
+func quoteCheckout(ctx context.Context, req CheckoutRequest) (checkoutQuote, error) {
+	if req.UserID == "" {
+		return checkoutQuote{}, fiber.NewError(fiber.StatusBadRequest, "user_id is required")
+	}
+
+	// 1. Fetch cart items and check them against the catalog
+	entries, lines, issues, err := loadCart(ctx, req.UserID)
+	if err != nil {
+		return checkoutQuote{}, err
+	}
+	if len(entries) == 0 {
+		return checkoutQuote{}, fiber.NewError(fiber.StatusBadRequest, "Cart is empty")
+	}
+
+	// Fetch User to check points
+	var user models.User
+	if err := db.UserCollection.FindOne(ctx, bson.M{"_id": req.UserID}).Decode(&user); err != nil {
+		return checkoutQuote{}, fiber.NewError(fiber.StatusBadRequest, "User not found")
+	}
+
+	var address *models.Address
+	if req.AddressID != "" {
+		address = &models.Address{}
+		filter := bson.M{"_id": req.AddressID, "user_id": req.UserID}
+		if err := db.AddressCollection.FindOne(ctx, filter).Decode(address); err != nil {
+			return checkoutQuote{}, fiber.NewError(fiber.StatusBadRequest, "Address not found")
+		}
+	}
+
+	// 2. Fetch selected campaigns, inactive ones are reported back as rejected
+	if req.CampaignIDs == nil {
+		req.CampaignIDs, err = cartCampaignIDs(ctx, req.UserID)
+		if err != nil {
+			return checkoutQuote{}, fiber.NewError(fiber.StatusInternalServerError, "Failed to fetch cart campaigns")
+		}
+	}
+	campaigns, err := findCampaigns(ctx, req.CampaignIDs)
+	if err != nil {
+		return checkoutQuote{}, err
+	}
+
+	// Fetch the categories of those campaigns, their rank sets the discount order
+	categories, err := findCampaignCategories(ctx, campaigns)
+	if err != nil {
+		return checkoutQuote{}, fiber.NewError(fiber.StatusInternalServerError, "Failed to fetch campaign categories")
+	}
+
+	// 3. Price the lines that can be bought
+	if len(lines) == 0 {
+		return checkoutQuote{}, &cartIssuesError{resp: CartIssuesResponse{
+			Error:  "None of the items in the cart are available",
+			Issues: issues,
+		}}
+	}
+
+	// Price the delivery of what is left; the address is also the tax region
+	var fee money.Money
+	var regions []string
+	if address != nil {
+		regions = []string{address.Province, address.Country}
+		parcel := shipping.Parcel{Address: *address}
+		for _, line := range lines {
+			parcel.Subtotal += line.Product.Price.Mul(int64(line.Quantity))
+			parcel.WeightGrams += line.Product.WeightGrams * line.Quantity
+			parcel.Items += line.Quantity
+		}
+		fee = Shipping.Fee(parcel)
+	}
+
+	quote, err := pricing.Calculate(pricing.Input{
+		Lines:      lines,
+		User:       user,
+		Campaigns:  campaigns,
+		Categories: categories,
+		PointUsed:  req.PointUsed,
+		Shipping:   fee,
+		Tax:        Taxes,
+		Regions:    regions,
+	})
+	var conflictErr *pricing.ConflictError
+	if errors.As(err, &conflictErr) {
+		return checkoutQuote{}, err
+	}
+	if errors.Is(err, pricing.ErrInsufficientPoints) {
+		return checkoutQuote{}, fiber.NewError(fiber.StatusBadRequest, "Insufficient points")
+	}
+	if errors.Is(err, pricing.ErrNegativePoints) {
+		return checkoutQuote{}, fiber.NewError(fiber.StatusBadRequest, "point_used cannot be negative")
+	}
+	if err != nil {
+		return checkoutQuote{}, fiber.NewError(fiber.StatusBadRequest, "Failed to price cart")
+	}
+
+	found := make(map[string]bool, len(campaigns))
+	for _, campaign := range campaigns {
+		found[campaign.ID] = true
+	}
+	for _, campaignID := range req.CampaignIDs {
+		if !found[campaignID] {
+			found[campaignID] = true
+			quote.Reject(campaignID, "", pricing.ReasonNotFound)
+		}
+	}
+
+	return checkoutQuote{Quote: quote, Issues: issues, Address: address}, nil
+}
+
+// unavailable returns the issues that keep a line out of the order.
+func unavailable(issues []CartIssue) []CartIssue {
+	var out []CartIssue
+	for _, issue := range issues {
+		if issue.Issue != IssuePriceChanged {
+			out = append(out, issue)
+		}
+	}
+	return out
+}
+
+// priceChanges returns the issues about changed prices.
+func priceChanges(issues []CartIssue) []CartIssue {
+	out := []CartIssue{}
+	for _, issue := range issues {
+		if issue.Issue == IssuePriceChanged {
+			out = append(out, issue)
+		}
+	}
+	return out
+}
+
+// findCampaigns returns the campaigns with ids that exist, with their target
+// categories. Errors are returned as *fiber.Error.
+func findCampaigns(ctx context.Context, ids []string) ([]models.Campaign, error) {
+	var campaigns []models.Campaign
+	if len(ids) > 0 {
+		cursor, err := db.CampaignCollection.Find(ctx, bson.M{"_id": bson.M{"$in": ids}})
+		if err != nil {
+			return nil, fiber.NewError(fiber.StatusInternalServerError, "Failed to fetch campaigns")
+		}
+		defer cursor.Close(ctx)
+		if err = cursor.All(ctx, &campaigns); err != nil {
+			return nil, fiber.NewError(fiber.StatusInternalServerError, "Failed to decode campaigns")
+		}
+	}
+
+	if err := attachTargetCategories(ctx, campaigns); err != nil {
+		return nil, fiber.NewError(fiber.StatusInternalServerError, "Failed to fetch campaign target categories")
+	}
+	return campaigns, nil
+}
+
+// attachTargetCategories fills each campaign's ProductCategories with the
+// product categories it targets. Only the IDs are set.
+func attachTargetCategories(ctx context.Context, campaigns []models.Campaign) error {
+	if len(campaigns) == 0 {
+		return nil
+	}
+
+	campaignIDs := make([]string, 0, len(campaigns))
+	for _, campaign := range campaigns {
+		campaignIDs = append(campaignIDs, campaign.ID)
+	}
+
+	cursor, err := db.CampaignTargetCategoryCollection.Find(ctx, bson.M{"campaign_id": bson.M{"$in": campaignIDs}})
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+
+	var targets []models.CampaignTargetCategory
+	if err = cursor.All(ctx, &targets); err != nil {
+		return err
+	}
+
+	byCampaign := make(map[string][]models.ProductCategory)
+	for _, target := range targets {
+		byCampaign[target.CampaignID] = append(byCampaign[target.CampaignID], models.ProductCategory{ID: target.ProductCategoryID})
+	}
+	for i := range campaigns {
+		campaigns[i].ProductCategories = byCampaign[campaigns[i].ID]
+	}
+	return nil
+}
+
+// findCampaignCategories returns the campaign categories referenced by
+// campaigns. Categories created through AddCampaignCategory have ObjectID
+// keys while campaigns store them as hex strings, so both forms are matched.
+func findCampaignCategories(ctx context.Context, campaigns []models.Campaign) ([]models.CampaignsCategories, error) {
+	var ids []interface{}
+	for _, campaign := range campaigns {
+		if campaign.CampaignCategoryID == "" {
+			continue
+		}
+		ids = append(ids, campaign.CampaignCategoryID)
+		if objID, err := primitive.ObjectIDFromHex(campaign.CampaignCategoryID); err == nil {
+			ids = append(ids, objID)
+		}
+	}
+
+	var categories []models.CampaignsCategories
+	if len(ids) == 0 {
+		return categories, nil
+	}
+
+	cursor, err := db.CampaignCategoryCollection.Find(ctx, bson.M{"_id": bson.M{"$in": ids}})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	if err = cursor.All(ctx, &categories); err != nil {
+		return nil, err
+	}
+	return categories, nil
+}
+
+// respondError writes err as an ErrorResponse, using the status carried by a
+// *fiber.Error and 500 for anything else. Campaign conflicts are sent as a
+// CampaignConflictResponse, and failed commits only expose their message.
+func respondError(c *fiber.Ctx, err error) error {
+	var conflictErr *pricing.ConflictError
+	if errors.As(err, &conflictErr) {
+		return c.Status(fiber.StatusBadRequest).JSON(CampaignConflictResponse{
+			Error:     "Only one campaign can be selected per campaign category",
+			Conflicts: conflictErr.Conflicts,
+		})
+	}
+	var issuesErr *cartIssuesError
+	if errors.As(err, &issuesErr) {
+		return c.Status(fiber.StatusConflict).JSON(issuesErr.resp)
+	}
+	var commitErr *commitError
+	if errors.As(err, &commitErr) {
+		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{Error: commitErr.message})
+	}
+	var fiberErr *fiber.Error
+	if errors.As(err, &fiberErr) {
+		return c.Status(fiberErr.Code).JSON(ErrorResponse{Error: fiberErr.Message})
+	}
+	return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{Error: "Internal server error"})
+}
+
+// PreviewCheckout godoc
+// @Summary Preview checkout totals
+// @Description Price the cart with the selected campaigns and points without deducting points, writing history or clearing the cart. Missing and inactive products are left out and listed in issues, together with lines whose price changed since they were added.
+// @Tags Checkout
+// @Accept json
+// @Produce json
+// @Param checkout body CheckoutRequest true "Checkout payload"
+// @Success 200 {object} CheckoutPreviewResponse
+// @Failure 400 {object} CampaignConflictResponse
+// @Failure 409 {object} CartIssuesResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /checkout/preview [post]
+func PreviewCheckout(c *fiber.Ctx) error {
+	var req CheckoutRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Error: "Invalid request body"})
+	}
+	if req.PointUsed < 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Error: "point_used cannot be negative"})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	quote, err := quoteCheckout(ctx, req)
+	if err != nil {
+		return respondError(c, err)
+	}
+
+	return c.JSON(CheckoutPreviewResponse{Quote: quote.Quote, Issues: quote.Issues, ShippingAddress: quote.Address})
 }
 
 // Checkout godoc
 // @Summary Checkout cart items
-// @Description Calculate total price, apply campaigns, and store transaction history
+// @Description Calculate total price, apply campaigns, take the payment and store transaction history. A cart with missing or inactive products, or more than is in stock, is refused with 409, and so is one whose total differs from expected_total, with the price changes that explain it. The order is paid once the payment provider confirms the capture; if it answers later the response is 202 and the order stays pending until the provider's webhook arrives.
 // @Tags Checkout
 // @Accept json
 // @Produce json
+// @Param Idempotency-Key header string false "Key that makes retries return the first response"
 // @Param checkout body CheckoutRequest true "Checkout payload"
 // @Success 200 {object} CheckoutResponse
-// @Failure 400 {object} ErrorResponse
+// @Success 202 {object} CheckoutResponse
+// @Failure 400 {object} CampaignConflictResponse
+// @Failure 402 {object} ErrorResponse
+// @Failure 409 {object} CartIssuesResponse
+// @Failure 422 {object} ErrorResponse
 // @Failure 500 {object} ErrorResponse
+// @Failure 502 {object} ErrorResponse
+// @Failure 504 {object} ErrorResponse
 // @Router /checkout [post]
 func Checkout(c *fiber.Ctx) error {
 	var req CheckoutRequest
 	if err := c.BodyParser(&req); err != nil {
 		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Error: "Invalid request body"})
 	}
-
-	if req.UserID == "" {
-		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Error: "user_id is required"})
+	if req.PointUsed < 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Error: "point_used cannot be negative"})
 	}
 
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
-	// 1. Fetch cart items
-	pipeline := mongo.Pipeline{
-		{{Key: "$match", Value: bson.M{"user_id": req.UserID}}},
-		{{Key: "$lookup", Value: bson.M{
-			"from":         "Products",
-			"localField":   "product_id",
-			"foreignField": "_id",
-			"as":           "product",
-		}}},
-		{{Key: "$unwind", Value: "$product"}},
-	}
-
-	cursor, err := db.CartCollection.Aggregate(ctx, pipeline)
+	quote, err := quoteCheckout(ctx, req)
 	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{Error: "Failed to fetch cart items"})
-	}
-	defer cursor.Close(ctx)
-
-	var cartItems []struct {
-		ProductID string         `bson:"product_id"`
-		Quantity  int            `bson:"quantity"`
-		Product   models.Product `bson:"product"`
+		return respondError(c, err)
 	}
-	if err = cursor.All(ctx, &cartItems); err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{Error: "Failed to decode cart items"})
+	if missing := unavailable(quote.Issues); len(missing) > 0 {
+		return respondError(c, &cartIssuesError{resp: CartIssuesResponse{
+			Error:  "Some items in the cart are no longer available",
+			Issues: missing,
+		}})
 	}
-
-	if len(cartItems) == 0 {
-		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Error: "Cart is empty"})
-	}
-
-	// Fetch User to check points
-	var user models.User
-	if err := db.UserCollection.FindOne(ctx, bson.M{"_id": req.UserID}).Decode(&user); err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Error: "User not found"})
+	if req.ExpectedTotal != nil && *req.ExpectedTotal != quote.Total {
+		return respondError(c, &cartIssuesError{resp: CartIssuesResponse{
+			Error:             "The total changed since it was shown",
+			Issues:            priceChanges(quote.Issues),
+			ExpectedTotal:     req.ExpectedTotal,
+			TotalPrice:        &quote.Total,
+			RejectedCampaigns: quote.RejectedCampaigns,
+		}})
 	}
 
-	if req.PointUsed > user.Point {
-		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Error: "Insufficient points"})
+	// 4. Hold the payment before anything is written
+	orderID := uuid.New().String()
+	var pay *models.OrderPayment
+	if quote.Total > 0 {
+		pay, err = authorizePayment(ctx, orderID, req.UserID, quote.Total)
+		if err != nil {
+			return respondError(c, err)
+		}
 	}
 
-	// 2. Calculate subtotal
-	var subtotal float64
-	for _, item := range cartItems {
-		subtotal += item.Product.Price * float64(item.Quantity)
+	// 5. Deduct points, write history and the order and clear the cart as one transaction
+	err = db.WithTransaction(ctx, func(txCtx context.Context) error {
+		return commitCheckout(txCtx, orderID, req.UserID, quote, pay)
+	})
+	if err != nil {
+		if pay != nil {
+			voidPayment(pay.PaymentID)
+		}
+		return respondError(c, err)
 	}
 
-	// 3. Apply campaigns
-	totalPrice := subtotal
-	if len(req.CampaignIDs) > 0 {
-		// Fetch selected campaigns
-		var campaigns []models.Campaign
-		campaignFilter := bson.M{
-			"_id":       bson.M{"$in": req.CampaignIDs},
-			"is_active": true,
-		}
-		campaignCursor, err := db.CampaignCollection.Find(ctx, campaignFilter)
-		if err != nil {
-			return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{Error: "Failed to fetch campaigns"})
-		}
-		defer campaignCursor.Close(ctx)
-		if err = campaignCursor.All(ctx, &campaigns); err != nil {
-			return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{Error: "Failed to decode campaigns"})
-		}
-
-		for _, campaign := range campaigns {
-			switch campaign.DiscountType {
-			case "percent":
-				discount := subtotal * (campaign.DiscountValue / 100)
-				totalPrice -= discount
-			case "fixed":
-				totalPrice -= campaign.DiscountValue
-			case "spendAndSave":
-				// Example: Spend 100 save 10
-				if campaign.Every > 0 && campaign.DiscountValue > 0 {
-					times := math.Floor(subtotal / campaign.Every)
-					discount := times * campaign.DiscountValue
-					if campaign.Limit > 0 && discount > campaign.Limit {
-						discount = campaign.Limit
-					}
-					totalPrice -= discount
-				}
+	// 6. Collect the payment; the order stays pending until the capture is confirmed
+	orderStatus := models.OrderPaid
+	if pay != nil {
+		orderStatus = models.OrderPending
+		if pay.Status == payment.StatusAuthorized {
+			orderStatus, err = captureOrderPayment(ctx, orderID, pay.PaymentID, quote.Total)
+			if err != nil {
+				return respondError(c, err)
 			}
 		}
 	}
 
-	// Apply Point Discount
-	if req.PointUsed > 0 {
-		totalPrice -= float64(req.PointUsed)
+	resp := CheckoutResponse{
+		TotalPrice:        quote.Total,
+		Subtotal:          quote.Subtotal,
+		Shipping:          quote.Shipping,
+		Lines:             quote.Lines,
+		Campaigns:         quote.Campaigns,
+		RejectedCampaigns: quote.RejectedCampaigns,
+		PointUsed:         quote.PointUsed,
+		PointDiscount:     quote.PointDiscount,
+		TaxMode:           quote.TaxMode,
+		Tax:               quote.Tax,
+		OrderID:           orderID,
+		OrderStatus:       orderStatus,
+		Issues:            quote.Issues,
+		Message:           "Checkout successful",
+	}
+	if orderStatus == models.OrderPending {
+		resp.Message = "Payment is processing"
+		return c.Status(fiber.StatusAccepted).JSON(resp)
 	}
+	return c.JSON(resp)
+}
 
-	if totalPrice < 0 {
-		totalPrice = 0
+// commitError is a failed checkout write. It keeps the driver error so its
+// labels reach db.WithTransaction, which relies on them to retry.
+type commitError struct {
+	message string
+	err     error
+}
+
+func (e *commitError) Error() string { return e.message + ": " + e.err.Error() }
+func (e *commitError) Unwrap() error { return e.err }
+
+// commitCheckout applies a priced checkout: it deducts the redeemed points,
+// records the transaction history and the order under orderID, and empties
+// the cart. The order keeps a copy of the shipping address, so later edits to
+// the saved address do not change it. An order with a payment is left pending for the capture; one
+// with nothing to pay is paid right away. Run it through db.WithTransaction
+// so the writes succeed or fail together.
+func commitCheckout(ctx context.Context, orderID, userID string, quote checkoutQuote, pay *models.OrderPayment) error {
+	// Deduct points from user, only if the balance still covers them. A
+	// concurrent checkout may have spent them since the quote was made.
+	// The quote already checked the stock, so a shortage here is a race.
+	if quote.PointUsed > 0 {
+		filter := bson.M{"_id": userID, "point": bson.M{"$gte": quote.PointUsed}}
+		update := bson.M{"$inc": bson.M{"point": -quote.PointUsed}}
+		result, err := db.UserCollection.UpdateOne(ctx, filter, update)
+		if err != nil {
+			return &commitError{message: "Failed to update user points", err: err}
+		}
+		if result.MatchedCount == 0 {
+			return fiber.NewError(fiber.StatusConflict, "Insufficient points, the balance changed during checkout")
+		}
 	}
 
-	// Deduct points from user
-	if req.PointUsed > 0 {
-		update := bson.M{"$inc": bson.M{"point": -req.PointUsed}}
-		if _, err := db.UserCollection.UpdateOne(ctx, bson.M{"_id": req.UserID}, update); err != nil {
-			return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{Error: "Failed to update user points"})
+	// Take the stock, using what the user reserved first
+	if taken, err := takeCheckoutStock(ctx, orderID, userID, quote.Lines); err != nil {
+		// Without a transaction the deduction and the stock taken for
+		// earlier lines are already written, so give them back
+		if !db.TransactionsSupported {
+			returnCheckoutStock(ctx, orderID, userID, taken)
+			if quote.PointUsed > 0 {
+				refund := bson.M{"$inc": bson.M{"point": quote.PointUsed}}
+				if _, undoErr := db.UserCollection.UpdateOne(ctx, bson.M{"_id": userID}, refund); undoErr != nil {
+					log.Printf("return %d points to user %s after failed checkout: %v", quote.PointUsed, userID, undoErr)
+				}
+			}
 		}
+		return err
 	}
 
-	// 4. Create History
-	historyID := uuid.New().String()
+	// Create History
+	now := time.Now()
+	historyID := orderID
 	history := models.TransactionHistory{
 		ID:        historyID,
-		UserID:    req.UserID,
-		PointUsed: req.PointUsed,
-		Date:      time.Now(),
+		UserID:    userID,
+		PointUsed: quote.PointUsed,
+		Date:      now,
 	}
 	if _, err := db.TransactionHistoryCollection.InsertOne(ctx, history); err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{Error: "Failed to create history"})
+		return &commitError{message: "Failed to create history", err: err}
+	}
+
+	// Create the Order, sharing the history ID
+	order := newOrder(historyID, userID, quote.Quote, now)
+	order.ShippingAddress = quote.Address
+	order.Payment = pay
+	if pay == nil {
+		if err := order.Transition(models.OrderPaid, now); err != nil {
+			return err
+		}
+	}
+	if _, err := db.OrderCollection.InsertOne(ctx, order); err != nil {
+		return &commitError{message: "Failed to create order", err: err}
 	}
 
-	// 5. Create HistoryProduct
+	// Create HistoryProduct
 	var historyProducts []interface{}
-	for _, item := range cartItems {
+	for _, line := range quote.Lines {
 		historyProducts = append(historyProducts, models.TransactionHistoryProduct{
-			HistoryID: historyID,
-			ProductID: item.ProductID,
+			HistoryID:           historyID,
+			ProductID:           line.ProductID,
+			ProductName:         line.ProductName,
+			ProductCategoryID:   line.ProductCategoryID,
+			ProductCategoryName: line.ProductCategoryName,
+			UnitPrice:           line.UnitPrice,
+			Quantity:            line.Quantity,
+			Discount:            line.Discount,
+			Total:               line.Total,
 		})
 	}
 	if len(historyProducts) > 0 {
 		if _, err := db.TransactionHistoryProductCollection.InsertMany(ctx, historyProducts); err != nil {
-			return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{Error: "Failed to create history products"})
+			return &commitError{message: "Failed to create history products", err: err}
 		}
 	}
 
-	// 6. Create HistoryCampaign
-	if len(req.CampaignIDs) > 0 {
+	// Create HistoryCampaign for the campaigns that were applied
+	if len(quote.Campaigns) > 0 {
 		var historyCampaigns []interface{}
-		for _, campaignID := range req.CampaignIDs {
+		for _, applied := range quote.Campaigns {
 			historyCampaigns = append(historyCampaigns, models.TransactionHistoryCampaign{
-				HistoryID:  historyID,
-				CampaignID: campaignID,
+				HistoryID:     historyID,
+				CampaignID:    applied.CampaignID,
+				Name:          applied.Name,
+				DiscountType:  applied.DiscountType,
+				DiscountValue: applied.DiscountValue,
+				Amount:        applied.Amount,
 			})
 		}
 		if _, err := db.TransactionHistoryCampaignCollection.InsertMany(ctx, historyCampaigns); err != nil {
-			return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{Error: "Failed to create history campaigns"})
+			return &commitError{message: "Failed to create history campaigns", err: err}
 		}
 	}
 
-	// 7. Clear cart
-	if _, err := db.CartCollection.DeleteMany(ctx, bson.M{"user_id": req.UserID}); err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{Error: "Failed to clear cart"})
+	// Clear cart and the campaigns attached to it
+	if _, err := db.CartCollection.DeleteMany(ctx, bson.M{"user_id": userID}); err != nil {
+		return &commitError{message: "Failed to clear cart", err: err}
+	}
+	if _, err := db.CartCampaignCollection.DeleteMany(ctx, bson.M{"user_id": userID}); err != nil {
+		return &commitError{message: "Failed to clear cart campaigns", err: err}
 	}
 
-	return c.JSON(CheckoutResponse{
-		TotalPrice: totalPrice,
-		Message:    "Checkout successful",
-	})
+	return nil
+}
+
+// newOrder builds a pending order holding a snapshot of quote.
+func newOrder(id, userID string, quote pricing.Quote, now time.Time) models.Order {
+	order := models.Order{
+		ID:               id,
+		UserID:           userID,
+		Status:           models.OrderPending,
+		Items:            make([]models.OrderItem, 0, len(quote.Lines)),
+		Campaigns:        make([]models.OrderCampaign, 0, len(quote.Campaigns)),
+		Subtotal:         quote.Subtotal,
+		ShippingFee:      quote.Shipping.Fee,
+		ShippingDiscount: quote.Shipping.Discount,
+		ShippingTaxRate:  quote.Shipping.TaxRate,
+		ShippingTax:      quote.Shipping.Tax,
+		Discount:         quote.Shipping.Discount,
+		PointUsed:        quote.PointUsed,
+		PointDiscount:    quote.PointDiscount,
+		TaxMode:          quote.TaxMode,
+		Tax:              quote.Tax,
+		Total:            quote.Total,
+		StatusHistory:    []models.OrderStatusChange{{Status: models.OrderPending, At: now}},
+		CreatedAt:        now,
+		UpdatedAt:        now,
+	}
+	for _, line := range quote.Lines {
+		order.Items = append(order.Items, models.OrderItem{
+			ProductID:           line.ProductID,
+			ProductName:         line.ProductName,
+			ProductCategoryID:   line.ProductCategoryID,
+			ProductCategoryName: line.ProductCategoryName,
+			UnitPrice:           line.UnitPrice,
+			Quantity:            line.Quantity,
+			LineTotal:           line.LineTotal,
+			Discount:            line.Discount,
+			Total:               line.Total,
+			TaxRate:             line.TaxRate,
+			Tax:                 line.Tax,
+		})
+		order.Discount += line.Discount
+	}
+	for _, applied := range quote.Campaigns {
+		targets := make([]string, 0, len(applied.Campaign.ProductCategories))
+		for _, category := range applied.Campaign.ProductCategories {
+			targets = append(targets, category.ID)
+		}
+		order.Campaigns = append(order.Campaigns, models.OrderCampaign{
+			CampaignID:         applied.CampaignID,
+			Name:               applied.Name,
+			DiscountType:       applied.DiscountType,
+			DiscountValue:      applied.DiscountValue,
+			Limit:              applied.Campaign.Limit,
+			Every:              applied.Campaign.Every,
+			CampaignCategoryID: applied.Campaign.CampaignCategoryID,
+			ProductCategoryIDs: targets,
+			ShippingScope:      applied.Campaign.ShippingScope,
+			Amount:             applied.Amount,
+		})
+	}
+	return order
 }
@@ -0,0 +1,228 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/faiisu/ecom-backend/internal/db"
+	"github.com/faiisu/ecom-backend/internal/models"
+	"github.com/faiisu/ecom-backend/internal/money"
+	"github.com/faiisu/ecom-backend/internal/pricing"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// connectTestMongo connects db to a throwaway database on the server in
+// TEST_MONGO_URL and drops it when the test ends. Tests that need Mongo are
+// skipped without it.
+func connectTestMongo(t *testing.T) {
+	t.Helper()
+	url := os.Getenv("TEST_MONGO_URL")
+	if url == "" {
+		t.Skip("TEST_MONGO_URL is not set")
+	}
+	name := "ecom_test_" + uuid.New().String()[:8]
+	if err := db.ConnectMongo(url, name); err != nil {
+		t.Fatalf("connect to %s: %v", url, err)
+	}
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if err := db.MongoClient.Database(name).Drop(ctx); err != nil {
+			t.Logf("drop %s: %v", name, err)
+		}
+		db.MongoClient.Disconnect(ctx)
+	})
+}
+
+// TestConcurrentCheckoutPoints runs many checkouts of the same user at once,
+// each redeeming the same points, and checks that the balance covers exactly
+// the ones that succeed.
+func TestConcurrentCheckoutPoints(t *testing.T) {
+	connectTestMongo(t)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	const (
+		checkouts = 20
+		balance   = 250
+		points    = 30
+	)
+	userID := uuid.New().String()
+	if _, err := db.UserCollection.InsertOne(ctx, models.User{ID: userID, Point: balance, IsGuest: true}); err != nil {
+		t.Fatal(err)
+	}
+	product := models.Product{ID: uuid.New().String(), Name: "Mug", Price: money.FromMajor(100), IsActive: true}
+	if _, err := db.ProductCollection.InsertOne(ctx, product); err != nil {
+		t.Fatal(err)
+	}
+
+	redeem := models.Campaign{ID: "points", Name: "Points", DiscountType: pricing.DiscountPoint, IsActive: true}
+	quote, err := pricing.Calculate(pricing.Input{
+		Lines:     []pricing.Line{{Product: product, Quantity: 1}},
+		User:      models.User{ID: userID, Point: balance},
+		Campaigns: []models.Campaign{redeem},
+		PointUsed: points,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if quote.PointUsed != points {
+		t.Fatalf("quote redeems %d points, want %d", quote.PointUsed, points)
+	}
+
+	var wg sync.WaitGroup
+	errs := make([]error, checkouts)
+	for i := range errs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			orderID := uuid.New().String()
+			errs[i] = db.WithTransaction(ctx, func(txCtx context.Context) error {
+				return commitCheckout(txCtx, orderID, userID, checkoutQuote{Quote: quote}, nil)
+			})
+		}(i)
+	}
+	wg.Wait()
+
+	succeeded := 0
+	for _, err := range errs {
+		var fiberErr *fiber.Error
+		switch {
+		case err == nil:
+			succeeded++
+		case errors.As(err, &fiberErr) && fiberErr.Code == fiber.StatusConflict:
+		default:
+			t.Errorf("checkout failed with %v, want success or 409", err)
+		}
+	}
+	if want := balance / points; succeeded != want {
+		t.Errorf("%d checkouts succeeded, want %d", succeeded, want)
+	}
+
+	var user models.User
+	if err := db.UserCollection.FindOne(ctx, bson.M{"_id": userID}).Decode(&user); err != nil {
+		t.Fatal(err)
+	}
+	if user.Point < 0 {
+		t.Errorf("balance went below zero: %d", user.Point)
+	}
+	if want := balance - succeeded*points; user.Point != want {
+		t.Errorf("balance = %d, want %d", user.Point, want)
+	}
+
+	orders, err := db.OrderCollection.CountDocuments(ctx, bson.M{"user_id": userID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if orders != int64(succeeded) {
+		t.Errorf("%d orders written for %d checkouts", orders, succeeded)
+	}
+	if t.Failed() {
+		t.Log(fmt.Sprint(errs))
+	}
+}
+
+// TestStandaloneCheckoutShortage runs a checkout without a transaction whose
+// last line sells out, and checks that the points and the stock taken for
+// the earlier line, its reservation included, are given back.
+func TestStandaloneCheckoutShortage(t *testing.T) {
+	connectTestMongo(t)
+	supported := db.TransactionsSupported
+	db.TransactionsSupported = false
+	t.Cleanup(func() { db.TransactionsSupported = supported })
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	const balance = 100
+	userID := uuid.New().String()
+	if _, err := db.UserCollection.InsertOne(ctx, models.User{ID: userID, Point: balance, IsGuest: true}); err != nil {
+		t.Fatal(err)
+	}
+	// 5 mugs, 2 of them reserved by the user, and no plates left
+	mugStock, plateStock := 3, 0
+	mug := models.Product{ID: uuid.New().String(), Name: "Mug", Price: money.FromMajor(100), IsActive: true, Stock: &mugStock}
+	plate := models.Product{ID: uuid.New().String(), Name: "Plate", Price: money.FromMajor(50), IsActive: true, Stock: &plateStock}
+	if _, err := db.ProductCollection.InsertMany(ctx, []interface{}{mug, plate}); err != nil {
+		t.Fatal(err)
+	}
+	reservation := models.StockReservation{
+		ID:        uuid.New().String(),
+		UserID:    userID,
+		ProductID: mug.ID,
+		Quantity:  2,
+		ExpiresAt: time.Now().Add(time.Hour),
+		CreatedAt: time.Now(),
+	}
+	if _, err := db.StockReservationCollection.InsertOne(ctx, reservation); err != nil {
+		t.Fatal(err)
+	}
+
+	quote, err := pricing.Calculate(pricing.Input{
+		Lines:     []pricing.Line{{Product: mug, Quantity: 3}, {Product: plate, Quantity: 1}},
+		User:      models.User{ID: userID, Point: balance},
+		Campaigns: []models.Campaign{{ID: "points", Name: "Points", DiscountType: pricing.DiscountPoint, IsActive: true}},
+		PointUsed: 30,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	orderID := uuid.New().String()
+	err = db.WithTransaction(ctx, func(txCtx context.Context) error {
+		return commitCheckout(txCtx, orderID, userID, checkoutQuote{Quote: quote}, nil)
+	})
+	var fiberErr *fiber.Error
+	if !errors.As(err, &fiberErr) || fiberErr.Code != fiber.StatusConflict {
+		t.Fatalf("checkout failed with %v, want 409", err)
+	}
+
+	var user models.User
+	if err := db.UserCollection.FindOne(ctx, bson.M{"_id": userID}).Decode(&user); err != nil {
+		t.Fatal(err)
+	}
+	if user.Point != balance {
+		t.Errorf("balance = %d, want %d", user.Point, balance)
+	}
+	var product models.Product
+	if err := db.ProductCollection.FindOne(ctx, bson.M{"_id": mug.ID}).Decode(&product); err != nil {
+		t.Fatal(err)
+	}
+	if product.Stock == nil || *product.Stock != 5 {
+		t.Errorf("mug stock = %v, want 5", product.Stock)
+	}
+
+	var movements []models.StockMovement
+	cursor, err := db.StockMovementCollection.Find(ctx, bson.M{"product_id": mug.ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cursor.All(ctx, &movements); err != nil {
+		t.Fatal(err)
+	}
+	change := 0
+	for _, movement := range movements {
+		change += movement.Change
+	}
+	// The sale of the one unreserved mug and the release of all three
+	if len(movements) != 2 || change != 2 {
+		t.Errorf("movements = %+v, want a sale of 1 and a release of 3", movements)
+	}
+
+	for _, collection := range []*mongo.Collection{db.OrderCollection, db.StockReservationCollection} {
+		count, err := collection.CountDocuments(ctx, bson.M{"user_id": userID})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if count != 0 {
+			t.Errorf("%d documents left in %s", count, collection.Name())
+		}
+	}
+}
@@ -0,0 +1,175 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/faiisu/ecom-backend/internal/db"
+	"github.com/faiisu/ecom-backend/internal/models"
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// IdempotencyTTL is how long a stored Idempotency-Key is honoured. It is set
+// from config at startup.
+var IdempotencyTTL = 24 * time.Hour
+
+const (
+	idempotencyProcessing = "processing"
+	idempotencyCompleted  = "completed"
+)
+
+// idempotencyLease is how long a request may stay processing before a retry
+// with the same key takes over, for when the first one crashed or was cut
+// off. It is well past the handlers' own timeouts, so a request still
+// running has given up by then.
+const idempotencyLease = time.Minute
+
+// IdempotencyKey makes the next handler safe to retry. A request carrying an
+// Idempotency-Key header runs once; repeats with the same key and payload get
+// the stored response back, and repeats with a different payload are rejected
+// with 422. Server errors are not stored, so the client can retry them, and a
+// request that never finished is retried once its lease runs out. Requests
+// without the header pass straight through.
+func IdempotencyKey(c *fiber.Ctx) error {
+	key := c.Get("Idempotency-Key")
+	if key == "" {
+		return c.Next()
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	hash := requestHash(c)
+	record, claim, err := claimIdempotencyKey(ctx, key, hash)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{Error: "Failed to check idempotency key"})
+	}
+
+	if record != nil {
+		if record.RequestHash != hash {
+			return c.Status(fiber.StatusUnprocessableEntity).JSON(ErrorResponse{Error: "Idempotency-Key was already used with a different payload"})
+		}
+		if record.Status != idempotencyCompleted {
+			return c.Status(fiber.StatusConflict).JSON(ErrorResponse{Error: "A request with this Idempotency-Key is still in progress"})
+		}
+		c.Set("Idempotent-Replayed", "true")
+		c.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+		return c.Status(record.ResponseStatus).Send(record.ResponseBody)
+	}
+
+	if err := c.Next(); err != nil {
+		releaseIdempotencyKey(claim)
+		return err
+	}
+
+	status := c.Response().StatusCode()
+	if status >= fiber.StatusInternalServerError {
+		releaseIdempotencyKey(claim)
+		return nil
+	}
+
+	saveCtx, saveCancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer saveCancel()
+
+	update := bson.M{"$set": bson.M{
+		"status":          idempotencyCompleted,
+		"response_status": status,
+		"response_body":   append([]byte(nil), c.Response().Body()...),
+	}}
+	result, err := db.IdempotencyCollection.UpdateOne(saveCtx, claim, update)
+	if err != nil {
+		// The request itself succeeded, so still answer it
+		releaseIdempotencyKey(claim)
+	} else if result.MatchedCount == 0 {
+		log.Printf("idempotency key %s: response not stored, a retry took the key over", key)
+	}
+	return nil
+}
+
+// claimIdempotencyKey stores key as processing and returns the filter that
+// matches this claim. If the key is already taken the existing record is
+// returned instead. An expired record that Mongo has not cleaned up yet is
+// replaced, and so is one for the same request still processing past its
+// deadline, whose request is taken to have died.
+func claimIdempotencyKey(ctx context.Context, key, hash string) (*models.IdempotencyKey, bson.M, error) {
+	now := time.Now()
+	record := models.IdempotencyKey{
+		Key:         key,
+		RequestHash: hash,
+		Status:      idempotencyProcessing,
+		Deadline:    now.Add(idempotencyLease),
+		CreatedAt:   now,
+		ExpiresAt:   now.Add(IdempotencyTTL),
+	}
+	claim := bson.M{"_id": key, "status": idempotencyProcessing, "deadline": record.Deadline}
+
+	for attempt := 0; attempt < 2; attempt++ {
+		_, err := db.IdempotencyCollection.InsertOne(ctx, record)
+		if err == nil {
+			return nil, claim, nil
+		}
+		if !mongo.IsDuplicateKeyError(err) {
+			return nil, nil, err
+		}
+
+		var existing models.IdempotencyKey
+		err = db.IdempotencyCollection.FindOne(ctx, bson.M{"_id": key}).Decode(&existing)
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			continue
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		if !existing.ExpiresAt.After(now) {
+			if _, err := db.IdempotencyCollection.DeleteOne(ctx, bson.M{"_id": key, "expires_at": existing.ExpiresAt}); err != nil {
+				return nil, nil, err
+			}
+			continue
+		}
+		if existing.Status != idempotencyProcessing || existing.RequestHash != hash || existing.Deadline.After(now) {
+			return &existing, nil, nil
+		}
+
+		// Take over from the dead request, unless another retry got there first
+		filter := bson.M{"_id": key, "status": idempotencyProcessing, "created_at": existing.CreatedAt}
+		result, err := db.IdempotencyCollection.ReplaceOne(ctx, filter, record)
+		if err != nil {
+			return nil, nil, err
+		}
+		if result.MatchedCount == 1 {
+			return nil, claim, nil
+		}
+	}
+	return nil, nil, errors.New("idempotency key could not be claimed")
+}
+
+// releaseIdempotencyKey forgets the key held by claim so the request can be
+// tried again. A key another request has taken over is left alone.
+func releaseIdempotencyKey(claim bson.M) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	_, _ = db.IdempotencyCollection.DeleteOne(ctx, claim)
+}
+
+// requestHash fingerprints the method, path and body of the request. JSON
+// bodies are compacted first so whitespace does not count as a change.
+func requestHash(c *fiber.Ctx) string {
+	body := c.Body()
+	var compact bytes.Buffer
+	if err := json.Compact(&compact, body); err == nil {
+		body = compact.Bytes()
+	}
+
+	sum := sha256.New()
+	sum.Write([]byte(c.Method() + " " + c.Path() + "\n"))
+	sum.Write(body)
+	return hex.EncodeToString(sum.Sum(nil))
+}
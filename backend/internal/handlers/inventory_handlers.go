@@ -0,0 +1,510 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/faiisu/ecom-backend/internal/db"
+	"github.com/faiisu/ecom-backend/internal/models"
+	"github.com/faiisu/ecom-backend/internal/pricing"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ReservationTTL is how long a checkout reservation holds stock. It is set
+// from config at startup.
+var ReservationTTL = 10 * time.Minute
+
+const (
+	defaultMovementsPageSize = 50
+	maxMovementsPageSize     = 200
+)
+
+type AdjustStockRequest struct {
+	Change *int   `json:"change,omitempty"` // added to the stock, negative to remove
+	Stock  *int   `json:"stock,omitempty"`  // sets the stock level, and starts tracking it
+	Reason string `json:"reason"`
+}
+
+type StockResponse struct {
+	ProductID string `json:"product_id"`
+	Stock     int    `json:"stock"`
+}
+
+type ReserveStockRequest struct {
+	UserID string `json:"user_id"`
+}
+
+type StockReservationResponse struct {
+	Reservations []models.StockReservation `json:"reservations"`
+	ExpiresAt    time.Time                 `json:"expires_at"`
+}
+
+// AdjustStock godoc
+// @Summary Adjust a product's stock
+// @Description Either adds change to the stock or sets it to stock. Setting it also starts tracking stock for a product that had none. Every adjustment is logged with its reason.
+// @Tags Inventory
+// @Accept json
+// @Produce json
+// @Param id path string true "Product ID"
+// @Param body body AdjustStockRequest true "Adjustment"
+// @Success 200 {object} StockResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /products/{id}/stock [patch]
+func AdjustStock(c *fiber.Ctx) error {
+	id := c.Params("id")
+	var req AdjustStockRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Error: "Invalid request body"})
+	}
+	if (req.Change == nil) == (req.Stock == nil) {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Error: "Send either change or stock"})
+	}
+	if req.Stock != nil && *req.Stock < 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Error: "stock cannot be negative"})
+	}
+	if req.Reason == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Error: "reason is required"})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var resp StockResponse
+	err := db.WithTransaction(ctx, func(txCtx context.Context) error {
+		var product models.Product
+		err := db.ProductCollection.FindOne(txCtx, bson.M{"_id": id}).Decode(&product)
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return fiber.NewError(fiber.StatusNotFound, "Product not found")
+		}
+		if err != nil {
+			return &commitError{message: "Failed to fetch product", err: err}
+		}
+
+		// Both forms only match the stock that was read, so a concurrent
+		// sale cannot be overwritten
+		current := 0
+		filter := bson.M{"_id": id, "stock": bson.M{"$exists": false}}
+		if product.Stock != nil {
+			current = *product.Stock
+			filter["stock"] = current
+		}
+		next := current
+		if req.Stock != nil {
+			next = *req.Stock
+		} else {
+			if product.Stock == nil {
+				return fiber.NewError(fiber.StatusConflict, "Stock is not tracked for this product, set it first")
+			}
+			next = current + *req.Change
+			if next < 0 {
+				return fiber.NewError(fiber.StatusConflict, "Only "+strconv.Itoa(current)+" left in stock")
+			}
+		}
+
+		result, err := db.ProductCollection.UpdateOne(txCtx, filter, bson.M{"$set": bson.M{"stock": next}})
+		if err != nil {
+			return &commitError{message: "Failed to update stock", err: err}
+		}
+		if result.MatchedCount == 0 {
+			return fiber.NewError(fiber.StatusConflict, "Stock changed, try again")
+		}
+		if err := logStockMovement(txCtx, models.StockMovement{
+			ProductID: id,
+			Type:      models.StockAdjustment,
+			Change:    next - current,
+			Reason:    req.Reason,
+		}); err != nil {
+			return err
+		}
+
+		resp = StockResponse{ProductID: id, Stock: next}
+		return nil
+	})
+	if err != nil {
+		return respondError(c, err)
+	}
+
+	return c.JSON(resp)
+}
+
+// GetStockMovements godoc
+// @Summary List a product's stock movements
+// @Description Newest first
+// @Tags Inventory
+// @Accept json
+// @Produce json
+// @Param id path string true "Product ID"
+// @Param limit query int false "Movements to return, at most 200" default(50)
+// @Success 200 {array} models.StockMovement
+// @Failure 400 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /products/{id}/stock/movements [get]
+func GetStockMovements(c *fiber.Ctx) error {
+	limit, err := strconv.Atoi(c.Query("limit", strconv.Itoa(defaultMovementsPageSize)))
+	if err != nil || limit < 1 || limit > maxMovementsPageSize {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Error: "limit must be between 1 and 200"})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	opts := options.Find().
+		SetSort(bson.D{{Key: "created_at", Value: -1}}).
+		SetLimit(int64(limit))
+	cursor, err := db.StockMovementCollection.Find(ctx, bson.M{"product_id": c.Params("id")}, opts)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{Error: "Failed to fetch stock movements"})
+	}
+	defer cursor.Close(ctx)
+
+	movements := []models.StockMovement{}
+	if err = cursor.All(ctx, &movements); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{Error: "Failed to decode stock movements"})
+	}
+
+	return c.JSON(movements)
+}
+
+// ReserveCartStock godoc
+// @Summary Reserve stock for checkout
+// @Description Holds the stock of every cart line for a few minutes so it cannot sell out during checkout. Earlier reservations of the user are released first. Checkout uses the reservation; unused stock goes back when it expires.
+// @Tags Checkout
+// @Accept json
+// @Produce json
+// @Param body body ReserveStockRequest true "User"
+// @Success 200 {object} StockReservationResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /checkout/reservations [post]
+func ReserveCartStock(c *fiber.Ctx) error {
+	var req ReserveStockRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Error: "Invalid request body"})
+	}
+	if req.UserID == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Error: "user_id is required"})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var resp StockReservationResponse
+	err := db.WithTransaction(ctx, func(txCtx context.Context) error {
+		if err := releaseReservations(txCtx, bson.M{"user_id": req.UserID}); err != nil {
+			return err
+		}
+
+		cursor, err := db.CartCollection.Find(txCtx, bson.M{"user_id": req.UserID})
+		if err != nil {
+			return &commitError{message: "Failed to fetch cart items", err: err}
+		}
+		var items []models.CartItem
+		if err := cursor.All(txCtx, &items); err != nil {
+			return &commitError{message: "Failed to decode cart items", err: err}
+		}
+		if len(items) == 0 {
+			return fiber.NewError(fiber.StatusBadRequest, "Cart is empty")
+		}
+
+		now := time.Now()
+		resp = StockReservationResponse{Reservations: []models.StockReservation{}, ExpiresAt: now.Add(ReservationTTL)}
+		for _, item := range items {
+			tracked, err := takeStock(txCtx, item.ProductID, item.Quantity)
+			if err != nil {
+				return err
+			}
+			if !tracked {
+				continue
+			}
+			reservation := models.StockReservation{
+				ID:        uuid.New().String(),
+				UserID:    req.UserID,
+				ProductID: item.ProductID,
+				Quantity:  item.Quantity,
+				ExpiresAt: resp.ExpiresAt,
+				CreatedAt: now,
+			}
+			if _, err := db.StockReservationCollection.InsertOne(txCtx, reservation); err != nil {
+				return &commitError{message: "Failed to create reservation", err: err}
+			}
+			if err := logStockMovement(txCtx, models.StockMovement{
+				ProductID:     item.ProductID,
+				Type:          models.StockReserve,
+				Change:        -item.Quantity,
+				UserID:        req.UserID,
+				ReservationID: reservation.ID,
+			}); err != nil {
+				return err
+			}
+			resp.Reservations = append(resp.Reservations, reservation)
+		}
+		return nil
+	})
+	if err != nil {
+		return respondError(c, err)
+	}
+
+	return c.JSON(resp)
+}
+
+// ReleaseCartStock godoc
+// @Summary Release reserved stock
+// @Description Gives back all stock reserved for the user, e.g. when they leave checkout
+// @Tags Checkout
+// @Accept json
+// @Produce json
+// @Param user_id path string true "User ID"
+// @Success 204
+// @Failure 500 {object} ErrorResponse
+// @Router /checkout/reservations/{user_id} [delete]
+func ReleaseCartStock(c *fiber.Ctx) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	err := db.WithTransaction(ctx, func(txCtx context.Context) error {
+		return releaseReservations(txCtx, bson.M{"user_id": c.Params("user_id")})
+	})
+	if err != nil {
+		return respondError(c, err)
+	}
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// SweepReservations gives back the stock of expired reservations every
+// interval, for as long as the process runs.
+func SweepReservations(interval time.Duration) {
+	for range time.Tick(interval) {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		cursor, err := db.StockReservationCollection.Find(ctx, bson.M{"expires_at": bson.M{"$lte": time.Now()}})
+		var expired []models.StockReservation
+		if err == nil {
+			err = cursor.All(ctx, &expired)
+		}
+		if err != nil {
+			log.Printf("sweep reservations: %v", err)
+		}
+		for _, reservation := range expired {
+			err := db.WithTransaction(ctx, func(txCtx context.Context) error {
+				return releaseReservation(txCtx, reservation)
+			})
+			if err != nil {
+				log.Printf("release reservation %s: %v", reservation.ID, err)
+			}
+		}
+		cancel()
+	}
+}
+
+// takeCheckoutStock takes the stock for the checkout of lines, using the
+// user's reservations first. Reservations for products no longer in the
+// cart are released. Run it inside the checkout transaction. It returns how
+// much of each product has left the stock for this checkout, reservations
+// included, also when it fails part way, so that a caller without a
+// transaction can give it back with returnCheckoutStock.
+func takeCheckoutStock(ctx context.Context, orderID, userID string, lines []pricing.QuoteLine) (map[string]int, error) {
+	taken := make(map[string]int, len(lines))
+	cursor, err := db.StockReservationCollection.Find(ctx, bson.M{"user_id": userID})
+	if err != nil {
+		return taken, &commitError{message: "Failed to fetch reservations", err: err}
+	}
+	var reservations []models.StockReservation
+	if err := cursor.All(ctx, &reservations); err != nil {
+		return taken, &commitError{message: "Failed to decode reservations", err: err}
+	}
+	reserved := make(map[string]models.StockReservation, len(reservations))
+	for _, reservation := range reservations {
+		reserved[reservation.ProductID] = reservation
+	}
+
+	for _, line := range lines {
+		// A reservation the sweeper already released holds nothing
+		held := 0
+		if reservation, ok := reserved[line.ProductID]; ok {
+			delete(reserved, line.ProductID)
+			result, err := db.StockReservationCollection.DeleteOne(ctx, bson.M{"_id": reservation.ID})
+			if err != nil {
+				return taken, &commitError{message: "Failed to use reservation", err: err}
+			}
+			if result.DeletedCount == 1 {
+				held = reservation.Quantity
+				taken[line.ProductID] += held
+			}
+		}
+
+		movement := models.StockMovement{ProductID: line.ProductID, OrderID: orderID, UserID: userID}
+		switch need := line.Quantity - held; {
+		case need > 0:
+			tracked, err := takeStock(ctx, line.ProductID, need)
+			if err != nil {
+				return taken, err
+			}
+			if !tracked {
+				continue
+			}
+			taken[line.ProductID] += need
+			movement.Type = models.StockSale
+			movement.Change = -need
+		case need < 0:
+			if _, err := putStock(ctx, line.ProductID, -need); err != nil {
+				return taken, err
+			}
+			taken[line.ProductID] += need
+			movement.Type = models.StockRelease
+			movement.Change = -need
+		default:
+			continue
+		}
+		if err := logStockMovement(ctx, movement); err != nil {
+			return taken, err
+		}
+	}
+
+	for _, reservation := range reserved {
+		if err := releaseReservation(ctx, reservation); err != nil {
+			return taken, err
+		}
+	}
+	return taken, nil
+}
+
+// returnCheckoutStock puts back the stock takeCheckoutStock took for a
+// checkout that failed without a transaction, logging it as released. It
+// carries on past errors, which it only logs, to return as much as it can.
+func returnCheckoutStock(ctx context.Context, orderID, userID string, taken map[string]int) {
+	for productID, quantity := range taken {
+		if quantity <= 0 {
+			continue
+		}
+		tracked, err := putStock(ctx, productID, quantity)
+		if err == nil && tracked {
+			err = logStockMovement(ctx, models.StockMovement{
+				ProductID: productID,
+				Type:      models.StockRelease,
+				Change:    quantity,
+				OrderID:   orderID,
+				UserID:    userID,
+			})
+		}
+		if err != nil {
+			log.Printf("return %d of product %s after failed checkout %s: %v", quantity, productID, orderID, err)
+		}
+	}
+}
+
+// reservedStock returns how much of each product the user has reserved.
+func reservedStock(ctx context.Context, userID string) (map[string]int, error) {
+	cursor, err := db.StockReservationCollection.Find(ctx, bson.M{"user_id": userID})
+	if err != nil {
+		return nil, err
+	}
+	var reservations []models.StockReservation
+	if err := cursor.All(ctx, &reservations); err != nil {
+		return nil, err
+	}
+	held := make(map[string]int, len(reservations))
+	for _, reservation := range reservations {
+		held[reservation.ProductID] += reservation.Quantity
+	}
+	return held, nil
+}
+
+// releaseReservations releases every reservation matching filter.
+func releaseReservations(ctx context.Context, filter bson.M) error {
+	cursor, err := db.StockReservationCollection.Find(ctx, filter)
+	if err != nil {
+		return &commitError{message: "Failed to fetch reservations", err: err}
+	}
+	var reservations []models.StockReservation
+	if err := cursor.All(ctx, &reservations); err != nil {
+		return &commitError{message: "Failed to decode reservations", err: err}
+	}
+	for _, reservation := range reservations {
+		if err := releaseReservation(ctx, reservation); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// releaseReservation deletes reservation and gives its stock back. Whoever
+// deletes the reservation first owns its stock, so a checkout and the
+// sweeper cannot both use it.
+func releaseReservation(ctx context.Context, reservation models.StockReservation) error {
+	result, err := db.StockReservationCollection.DeleteOne(ctx, bson.M{"_id": reservation.ID})
+	if err != nil {
+		return &commitError{message: "Failed to release reservation", err: err}
+	}
+	if result.DeletedCount == 0 {
+		return nil
+	}
+	tracked, err := putStock(ctx, reservation.ProductID, reservation.Quantity)
+	if err != nil || !tracked {
+		return err
+	}
+	return logStockMovement(ctx, models.StockMovement{
+		ProductID:     reservation.ProductID,
+		Type:          models.StockRelease,
+		Change:        reservation.Quantity,
+		UserID:        reservation.UserID,
+		ReservationID: reservation.ID,
+	})
+}
+
+// takeStock removes quantity from the stock of productID, only if that much
+// is left. It reports whether the product tracks stock at all; untracked
+// products are never short.
+func takeStock(ctx context.Context, productID string, quantity int) (bool, error) {
+	filter := bson.M{"_id": productID, "stock": bson.M{"$gte": quantity}}
+	result, err := db.ProductCollection.UpdateOne(ctx, filter, bson.M{"$inc": bson.M{"stock": -quantity}})
+	if err != nil {
+		return false, &commitError{message: "Failed to update stock", err: err}
+	}
+	if result.MatchedCount == 1 {
+		return true, nil
+	}
+
+	var product models.Product
+	err = db.ProductCollection.FindOne(ctx, bson.M{"_id": productID}).Decode(&product)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return false, fiber.NewError(fiber.StatusConflict, "Product "+productID+" is no longer available")
+	}
+	if err != nil {
+		return false, &commitError{message: "Failed to check stock", err: err}
+	}
+	if product.Stock == nil {
+		return false, nil
+	}
+	return true, fiber.NewError(fiber.StatusConflict, "Only "+strconv.Itoa(*product.Stock)+" of "+product.Name+" left in stock")
+}
+
+// putStock adds quantity back to the stock of productID if it is tracked.
+func putStock(ctx context.Context, productID string, quantity int) (bool, error) {
+	filter := bson.M{"_id": productID, "stock": bson.M{"$exists": true}}
+	result, err := db.ProductCollection.UpdateOne(ctx, filter, bson.M{"$inc": bson.M{"stock": quantity}})
+	if err != nil {
+		return false, &commitError{message: "Failed to update stock", err: err}
+	}
+	return result.MatchedCount == 1, nil
+}
+
+// logStockMovement records movement, filling in its ID and time.
+func logStockMovement(ctx context.Context, movement models.StockMovement) error {
+	movement.ID = uuid.New().String()
+	movement.CreatedAt = time.Now()
+	if _, err := db.StockMovementCollection.InsertOne(ctx, movement); err != nil {
+		return &commitError{message: "Failed to log stock movement", err: err}
+	}
+	return nil
+}
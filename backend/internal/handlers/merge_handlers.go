@@ -0,0 +1,289 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/faiisu/ecom-backend/internal/db"
+	"github.com/faiisu/ecom-backend/internal/models"
+	"github.com/faiisu/ecom-backend/internal/pricing"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// What happens to the campaigns attached to a guest's cart when it is merged.
+const (
+	MergeCampaignsKeep    = "keep"    // the user's campaigns stay and the guest's are dropped
+	MergeCampaignsAdd     = "add"     // the guest's campaigns are added unless they clash with the user's
+	MergeCampaignsReplace = "replace" // the guest's campaigns, if any, replace the user's
+)
+
+// GuestMergePolicy decides what a guest brings along when it is merged into
+// a user, besides its cart lines.
+type GuestMergePolicy struct {
+	Campaigns string
+	MaxPoints int // most guest points moved to the user; 0 moves none, -1 all
+}
+
+// GuestMerge is the policy for merging guests. It is set from config at
+// startup.
+var GuestMerge = GuestMergePolicy{Campaigns: MergeCampaignsAdd}
+
+// ParseGuestMergePolicy builds a policy from a campaigns mode (keep, add or
+// replace, default add) and a points limit (none, all or a number of
+// points, default none).
+func ParseGuestMergePolicy(campaigns, points string) (GuestMergePolicy, error) {
+	policy := GuestMergePolicy{Campaigns: MergeCampaignsAdd}
+	switch campaigns {
+	case "":
+	case MergeCampaignsKeep, MergeCampaignsAdd, MergeCampaignsReplace:
+		policy.Campaigns = campaigns
+	default:
+		return GuestMergePolicy{}, fmt.Errorf("unknown campaigns mode %q", campaigns)
+	}
+
+	switch points = strings.TrimSpace(points); points {
+	case "", "none":
+	case "all":
+		policy.MaxPoints = -1
+	default:
+		n, err := strconv.Atoi(points)
+		if err != nil || n < 0 {
+			return GuestMergePolicy{}, fmt.Errorf("invalid points limit %q", points)
+		}
+		policy.MaxPoints = n
+	}
+	return policy, nil
+}
+
+type MergeGuestRequest struct {
+	GuestID string `json:"guest_id"`
+}
+
+type MergeGuestResponse struct {
+	UserID      string   `json:"user_id"`
+	GuestID     string   `json:"guest_id"`
+	ItemsMoved  int      `json:"items_moved"`  // cart lines taken from the guest
+	CampaignIDs []string `json:"campaign_ids"` // attached to the user's cart after the merge
+	PointsMoved int      `json:"points_moved"`
+	Point       int      `json:"point"` // the user's balance after the merge
+	Message     string   `json:"message"`
+}
+
+// MergeGuest godoc
+// @Summary Merge a guest into a user
+// @Description Moves a guest's cart into the user's cart when the person behind it signs up or signs in, adding quantities of the same product together. The guest's attached campaigns and unused points carry over as the merge policy allows, its reserved stock is given back and the guest is retired. A retired guest cannot be merged again.
+// @Tags Auth
+// @Accept json
+// @Produce json
+// @Param id path string true "User ID"
+// @Param merge body MergeGuestRequest true "Guest to merge"
+// @Success 200 {object} MergeGuestResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /users/{id}/merge [post]
+func MergeGuest(c *fiber.Ctx) error {
+	userID := c.Params("id")
+	var req MergeGuestRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Error: "Invalid request body"})
+	}
+	if req.GuestID == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Error: "guest_id is required"})
+	}
+	if req.GuestID == userID {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Error: "A user cannot be merged into itself"})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var resp MergeGuestResponse
+	err := db.WithTransaction(ctx, func(txCtx context.Context) error {
+		resp = MergeGuestResponse{UserID: userID, GuestID: req.GuestID}
+
+		var user, guest models.User
+		if err := findMergeUser(txCtx, userID, &user); err != nil {
+			return err
+		}
+		if user.IsGuest {
+			return fiber.NewError(fiber.StatusConflict, "Guests can only be merged into a registered user")
+		}
+		if err := findMergeUser(txCtx, req.GuestID, &guest); err != nil {
+			return err
+		}
+		if !guest.IsGuest {
+			return fiber.NewError(fiber.StatusConflict, "Only guest users can be merged")
+		}
+		if guest.MergedInto != "" {
+			return fiber.NewError(fiber.StatusConflict, "Guest has already been merged")
+		}
+
+		// Retire the guest before anything moves, so that of two merges
+		// racing without a transaction only one gets its cart and points.
+		// The guest keeps its orders, but has no points left to spend.
+		filter := bson.M{"_id": guest.ID, "merged_into": bson.M{"$exists": false}}
+		retire := bson.M{"$set": bson.M{"point": 0, "merged_into": user.ID}}
+		err := db.UserCollection.FindOneAndUpdate(txCtx, filter, retire).Decode(&guest)
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return fiber.NewError(fiber.StatusConflict, "Guest has already been merged")
+		}
+		if err != nil {
+			return &commitError{message: "Failed to retire guest", err: err}
+		}
+
+		if resp.ItemsMoved, err = mergeCartItems(txCtx, guest.ID, user.ID); err != nil {
+			return err
+		}
+		if resp.CampaignIDs, err = mergeCartCampaigns(txCtx, guest.ID, user.ID); err != nil {
+			return err
+		}
+		if err := releaseReservations(txCtx, bson.M{"user_id": guest.ID}); err != nil {
+			return err
+		}
+
+		// guest holds the balance it had when it was retired
+		resp.PointsMoved = guest.Point
+		if GuestMerge.MaxPoints >= 0 && resp.PointsMoved > GuestMerge.MaxPoints {
+			resp.PointsMoved = GuestMerge.MaxPoints
+		}
+		resp.Point = user.Point + resp.PointsMoved
+		if _, err := db.UserCollection.UpdateByID(txCtx, user.ID, bson.M{"$inc": bson.M{"point": resp.PointsMoved}}); err != nil {
+			return &commitError{message: "Failed to update user points", err: err}
+		}
+		return nil
+	})
+	if err != nil {
+		return respondError(c, err)
+	}
+
+	resp.Message = "Guest merged successfully"
+	return c.JSON(resp)
+}
+
+// findMergeUser loads the user with id into user.
+func findMergeUser(ctx context.Context, id string, user *models.User) error {
+	err := db.UserCollection.FindOne(ctx, bson.M{"_id": id}).Decode(user)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return fiber.NewError(fiber.StatusNotFound, "User "+id+" not found")
+	}
+	if err != nil {
+		return &commitError{message: "Failed to fetch user", err: err}
+	}
+	return nil
+}
+
+// mergeCartItems moves the guest's cart lines to the user, adding to the
+// quantity of a line the user already has for the product. That line keeps
+// its price; a new line keeps the guest's. It returns the lines moved.
+func mergeCartItems(ctx context.Context, guestID, userID string) (int, error) {
+	cursor, err := db.CartCollection.Find(ctx, bson.M{"user_id": guestID})
+	if err != nil {
+		return 0, &commitError{message: "Failed to fetch guest cart", err: err}
+	}
+	var items []models.CartItem
+	if err := cursor.All(ctx, &items); err != nil {
+		return 0, &commitError{message: "Failed to decode guest cart", err: err}
+	}
+
+	for _, item := range items {
+		filter := bson.M{"user_id": userID, "product_id": item.ProductID}
+		update := bson.M{
+			"$inc":         bson.M{"quantity": item.Quantity},
+			"$setOnInsert": bson.M{"_id": uuid.New().String(), "unit_price": item.UnitPrice},
+		}
+		if _, err := upsertCartItem(ctx, filter, update); err != nil {
+			return 0, &commitError{message: "Failed to merge cart item", err: err}
+		}
+	}
+	if _, err := db.CartCollection.DeleteMany(ctx, bson.M{"user_id": guestID}); err != nil {
+		return 0, &commitError{message: "Failed to clear guest cart", err: err}
+	}
+	return len(items), nil
+}
+
+// mergeCartCampaigns carries the campaigns attached to the guest's cart over
+// to the user's as GuestMerge.Campaigns says, clears the guest's, and
+// returns the IDs attached to the user's cart afterwards. When adding, a
+// guest campaign is skipped if it is already attached, no longer active or
+// would share an exclusive campaign category with one that is.
+func mergeCartCampaigns(ctx context.Context, guestID, userID string) ([]string, error) {
+	guestIDs, err := cartCampaignIDs(ctx, guestID)
+	if err != nil {
+		return nil, &commitError{message: "Failed to fetch guest cart campaigns", err: err}
+	}
+	userIDs, err := cartCampaignIDs(ctx, userID)
+	if err != nil {
+		return nil, &commitError{message: "Failed to fetch cart campaigns", err: err}
+	}
+	if _, err := db.CartCampaignCollection.DeleteMany(ctx, bson.M{"user_id": guestID}); err != nil {
+		return nil, &commitError{message: "Failed to clear guest cart campaigns", err: err}
+	}
+	if len(guestIDs) == 0 {
+		return userIDs, nil
+	}
+
+	var attach []string
+	switch GuestMerge.Campaigns {
+	case MergeCampaignsKeep:
+		return userIDs, nil
+	case MergeCampaignsReplace:
+		if _, err := db.CartCampaignCollection.DeleteMany(ctx, bson.M{"user_id": userID}); err != nil {
+			return nil, &commitError{message: "Failed to clear cart campaigns", err: err}
+		}
+		userIDs, attach = []string{}, guestIDs
+	default:
+		candidates, err := findCampaigns(ctx, guestIDs)
+		if err != nil {
+			return nil, err
+		}
+		selection, err := findCampaigns(ctx, userIDs)
+		if err != nil {
+			return nil, err
+		}
+		categories, err := findCampaignCategories(ctx, append(selection, candidates...))
+		if err != nil {
+			return nil, &commitError{message: "Failed to fetch campaign categories", err: err}
+		}
+
+		attached := make(map[string]bool, len(userIDs))
+		for _, id := range userIDs {
+			attached[id] = true
+		}
+		byID := make(map[string]models.Campaign, len(candidates))
+		for _, campaign := range candidates {
+			byID[campaign.ID] = campaign
+		}
+		for _, id := range guestIDs {
+			campaign, ok := byID[id]
+			if !ok || !campaign.IsActive || attached[id] {
+				continue
+			}
+			if len(pricing.FindConflicts(append(selection, campaign), categories)) > 0 {
+				continue
+			}
+			selection = append(selection, campaign)
+			attach = append(attach, id)
+		}
+	}
+
+	// Space the times out so they keep their order, after the user's own
+	now := time.Now()
+	for i, id := range attach {
+		filter := bson.M{"user_id": userID, "campaign_id": id}
+		update := bson.M{"$setOnInsert": bson.M{"attached_at": now.Add(time.Duration(i) * time.Millisecond)}}
+		if _, err := db.CartCampaignCollection.UpdateOne(ctx, filter, update, options.Update().SetUpsert(true)); err != nil {
+			return nil, &commitError{message: "Failed to attach campaign", err: err}
+		}
+	}
+	return append(userIDs, attach...), nil
+}
@@ -0,0 +1,279 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/faiisu/ecom-backend/internal/db"
+	"github.com/faiisu/ecom-backend/internal/models"
+	"github.com/faiisu/ecom-backend/internal/money"
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const (
+	defaultOrdersPageSize = 20
+	maxOrdersPageSize     = 100
+)
+
+type OrderSummary struct {
+	ID        string      `json:"id" bson:"_id"`
+	Status    string      `json:"status" bson:"status"`
+	ItemCount int         `json:"item_count" bson:"item_count"`
+	Subtotal  money.Money `json:"subtotal" bson:"subtotal"`
+	Discount  money.Money `json:"discount" bson:"discount"`
+	PointUsed int         `json:"point_used" bson:"point_used"`
+	Total     money.Money `json:"total" bson:"total"`
+	CreatedAt time.Time   `json:"created_at" bson:"created_at"`
+}
+
+type OrderListResponse struct {
+	Orders []OrderSummary `json:"orders"`
+	Page   int            `json:"page"`
+	Limit  int            `json:"limit"`
+	Total  int            `json:"total"`
+}
+
+// GetUserOrders godoc
+// @Summary List a user's orders
+// @Description Newest first, paginated, optionally limited to a date range. Dates are RFC 3339 or YYYY-MM-DD; "to" is inclusive of the whole day when given as a date.
+// @Tags Orders
+// @Accept json
+// @Produce json
+// @Param id path string true "User ID"
+// @Param page query int false "Page number, from 1" default(1)
+// @Param limit query int false "Orders per page, at most 100" default(20)
+// @Param from query string false "Only orders created at or after this time"
+// @Param to query string false "Only orders created at or before this time"
+// @Success 200 {object} OrderListResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /users/{id}/orders [get]
+func GetUserOrders(c *fiber.Ctx) error {
+	userID := c.Params("id")
+
+	page, err := strconv.Atoi(c.Query("page", "1"))
+	if err != nil || page < 1 {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Error: "page must be a positive number"})
+	}
+	limit, err := strconv.Atoi(c.Query("limit", strconv.Itoa(defaultOrdersPageSize)))
+	if err != nil || limit < 1 || limit > maxOrdersPageSize {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Error: "limit must be between 1 and 100"})
+	}
+
+	match := bson.M{"user_id": userID}
+	createdAt := bson.M{}
+	if raw := c.Query("from"); raw != "" {
+		from, _, err := parseDateParam(raw)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Error: "Invalid from date"})
+		}
+		createdAt["$gte"] = from
+	}
+	if raw := c.Query("to"); raw != "" {
+		to, isDate, err := parseDateParam(raw)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Error: "Invalid to date"})
+		}
+		if isDate {
+			createdAt["$lt"] = to.AddDate(0, 0, 1)
+		} else {
+			createdAt["$lte"] = to
+		}
+	}
+	if len(createdAt) > 0 {
+		match["created_at"] = createdAt
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: match}},
+		{{Key: "$sort", Value: bson.D{{Key: "created_at", Value: -1}, {Key: "_id", Value: -1}}}},
+		{{Key: "$facet", Value: bson.M{
+			"orders": bson.A{
+				bson.M{"$skip": (page - 1) * limit},
+				bson.M{"$limit": limit},
+				bson.M{"$project": bson.M{
+					"status":     1,
+					"item_count": bson.M{"$sum": "$items.quantity"},
+					"subtotal":   1,
+					"discount":   1,
+					"point_used": 1,
+					"total":      1,
+					"created_at": 1,
+				}},
+			},
+			"count": bson.A{
+				bson.M{"$count": "total"},
+			},
+		}}},
+	}
+
+	cursor, err := db.OrderCollection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{Error: "Failed to fetch orders"})
+	}
+	defer cursor.Close(ctx)
+
+	var results []struct {
+		Orders []OrderSummary `bson:"orders"`
+		Count  []struct {
+			Total int `bson:"total"`
+		} `bson:"count"`
+	}
+	if err = cursor.All(ctx, &results); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{Error: "Failed to decode orders"})
+	}
+
+	resp := OrderListResponse{Orders: []OrderSummary{}, Page: page, Limit: limit}
+	if len(results) > 0 {
+		if results[0].Orders != nil {
+			resp.Orders = results[0].Orders
+		}
+		if len(results[0].Count) > 0 {
+			resp.Total = results[0].Count[0].Total
+		}
+	}
+
+	return c.JSON(resp)
+}
+
+// GetOrder godoc
+// @Summary Get an order
+// @Description Full order with its item lines, applied campaigns, points and status history
+// @Tags Orders
+// @Accept json
+// @Produce json
+// @Param id path string true "Order ID"
+// @Success 200 {object} models.Order
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /orders/{id} [get]
+func GetOrder(c *fiber.Ctx) error {
+	id := c.Params("id")
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"_id": id}}},
+		{{Key: "$limit", Value: 1}},
+	}
+
+	cursor, err := db.OrderCollection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{Error: "Failed to fetch order"})
+	}
+	defer cursor.Close(ctx)
+
+	var orders []models.Order
+	if err = cursor.All(ctx, &orders); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{Error: "Failed to decode order"})
+	}
+	if len(orders) == 0 {
+		return c.Status(fiber.StatusNotFound).JSON(ErrorResponse{Error: "Order not found"})
+	}
+
+	return c.JSON(orders[0])
+}
+
+// parseDateParam reads an RFC 3339 timestamp or a YYYY-MM-DD date (UTC) and
+// reports which form it was.
+func parseDateParam(raw string) (time.Time, bool, error) {
+	if t, err := time.Parse(time.RFC3339, raw); err == nil {
+		return t, false, nil
+	}
+	t, err := time.Parse(time.DateOnly, raw)
+	return t, true, err
+}
+
+type UpdateOrderStatusRequest struct {
+	Status string `json:"status"`
+}
+
+// UpdateOrderStatus godoc
+// @Summary Change an order's status
+// @Description Marks a paid order fulfilled. Orders become paid only when their payment is captured. Cancelling and refunding go through POST /orders/{id}/cancel and POST /orders/{id}/refunds, which also return points, stock and payment; other transitions are rejected.
+// @Tags Orders
+// @Accept json
+// @Produce json
+// @Param id path string true "Order ID"
+// @Param body body UpdateOrderStatusRequest true "New status"
+// @Success 200 {object} models.Order
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /orders/{id}/status [patch]
+func UpdateOrderStatus(c *fiber.Ctx) error {
+	id := c.Params("id")
+	var req UpdateOrderStatusRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Error: "Invalid request body"})
+	}
+	if req.Status == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Error: "status is required"})
+	}
+	switch req.Status {
+	case models.OrderPaid:
+		return c.Status(fiber.StatusConflict).JSON(ErrorResponse{Error: "Orders are marked paid when their payment is captured"})
+	case models.OrderCancelled:
+		return c.Status(fiber.StatusConflict).JSON(ErrorResponse{Error: "Use POST /orders/" + id + "/cancel to cancel an order"})
+	case models.OrderRefunded:
+		return c.Status(fiber.StatusConflict).JSON(ErrorResponse{Error: "Use POST /orders/" + id + "/refunds to refund an order"})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	order, err := transitionOrder(ctx, id, req.Status, nil)
+	if err != nil {
+		return respondError(c, err)
+	}
+
+	return c.JSON(order)
+}
+
+// transitionOrder moves order id to status and stores the change along with
+// any extra fields in set. The update only matches while the order still has
+// the status it was read with, so two concurrent transitions cannot both
+// succeed.
+func transitionOrder(ctx context.Context, id, status string, set bson.M) (models.Order, error) {
+	var order models.Order
+	err := db.OrderCollection.FindOne(ctx, bson.M{"_id": id}).Decode(&order)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return order, fiber.NewError(fiber.StatusNotFound, "Order not found")
+	}
+	if err != nil {
+		return order, fiber.NewError(fiber.StatusInternalServerError, "Failed to fetch order")
+	}
+
+	from := order.Status
+	now := time.Now()
+	if err := order.Transition(status, now); err != nil {
+		return order, fiber.NewError(fiber.StatusConflict, "Order cannot move from "+from+" to "+status)
+	}
+
+	fields := bson.M{"status": status, "updated_at": now}
+	for key, value := range set {
+		fields[key] = value
+	}
+	filter := bson.M{"_id": id, "status": from}
+	update := bson.M{
+		"$set":  fields,
+		"$push": bson.M{"status_history": models.OrderStatusChange{Status: status, At: now}},
+	}
+	result, err := db.OrderCollection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return order, fiber.NewError(fiber.StatusInternalServerError, "Failed to update order")
+	}
+	if result.MatchedCount == 0 {
+		return order, fiber.NewError(fiber.StatusConflict, "Order status changed, try again")
+	}
+
+	return order, nil
+}
@@ -0,0 +1,297 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/faiisu/ecom-backend/internal/db"
+	"github.com/faiisu/ecom-backend/internal/models"
+	"github.com/faiisu/ecom-backend/internal/money"
+	"github.com/faiisu/ecom-backend/internal/payment"
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Payments is the payment provider used by checkout, refunds and the
+// webhook. It is set from config at startup.
+var Payments payment.Provider = payment.NewFake("")
+
+// paymentFailed is the payment status stored when a provider call errored.
+const paymentFailed = "failed"
+
+// authorizePayment holds amount for orderID. Declines come back as 402 and
+// timeouts as 504, after releasing whatever the provider may have held.
+func authorizePayment(ctx context.Context, orderID, userID string, amount money.Money) (*models.OrderPayment, error) {
+	result, err := Payments.Authorize(ctx, payment.AuthorizeRequest{OrderID: orderID, UserID: userID, Amount: amount})
+	switch {
+	case errors.Is(err, payment.ErrDeclined):
+		return nil, fiber.NewError(fiber.StatusPaymentRequired, "Payment declined")
+	case errors.Is(err, payment.ErrTimeout):
+		if result.PaymentID != "" {
+			voidPayment(result.PaymentID)
+		}
+		return nil, fiber.NewError(fiber.StatusGatewayTimeout, "Payment provider timed out")
+	case err != nil:
+		log.Printf("payment authorize for order %s: %v", orderID, err)
+		return nil, fiber.NewError(fiber.StatusBadGateway, "Payment failed")
+	}
+
+	return &models.OrderPayment{
+		Provider:  Payments.Name(),
+		PaymentID: result.PaymentID,
+		Status:    result.Status,
+		Amount:    amount,
+		UpdatedAt: time.Now(),
+	}, nil
+}
+
+// captureOrderPayment collects the authorized payment of a pending order and
+// returns the order's status afterwards. A declined capture cancels the order
+// and is returned as 402. When the provider does not confirm the capture the
+// order stays pending for the webhook, or for ReconcilePayments if the answer
+// was lost; this is not an error because the order already exists.
+func captureOrderPayment(ctx context.Context, orderID, paymentID string, amount money.Money) (string, error) {
+	result, err := Payments.Capture(ctx, paymentID, amount)
+	switch {
+	case errors.Is(err, payment.ErrDeclined):
+		if err := cancelOrderForPayment(ctx, orderID, payment.StatusDeclined); err != nil {
+			log.Printf("cancel order %s after declined capture: %v", orderID, err)
+		}
+		return "", fiber.NewError(fiber.StatusPaymentRequired, "Payment declined, the order was cancelled")
+	case err != nil:
+		log.Printf("payment capture for order %s: %v", orderID, err)
+		return models.OrderPending, nil
+	case result.Status == payment.StatusPending:
+		if err := setOrderPaymentStatus(ctx, orderID, payment.StatusPending); err != nil {
+			log.Printf("order %s: %v", orderID, err)
+		}
+		return models.OrderPending, nil
+	}
+
+	now := time.Now()
+	set := bson.M{"payment.status": payment.StatusCaptured, "payment.updated_at": now}
+	if _, err := transitionOrder(ctx, orderID, models.OrderPaid, set); err != nil {
+		log.Printf("mark order %s paid after capture: %v", orderID, err)
+		return models.OrderPending, nil
+	}
+	return models.OrderPaid, nil
+}
+
+// voidPayment releases an authorization that no order will use. It runs on
+// its own context because the request may already have timed out.
+func voidPayment(paymentID string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if _, err := Payments.Void(ctx, paymentID); err != nil {
+		log.Printf("void payment %s: %v", paymentID, err)
+	}
+}
+
+// cancelOrderForPayment cancels a pending order whose payment did not go
+// through, returning its points, and records the payment status.
+func cancelOrderForPayment(ctx context.Context, orderID, paymentStatus string) error {
+	err := db.WithTransaction(ctx, func(txCtx context.Context) error {
+		_, _, err := refundOrder(txCtx, orderID, models.RefundCancel, nil, "payment "+paymentStatus)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	return setOrderPaymentStatus(ctx, orderID, paymentStatus)
+}
+
+// setOrderPaymentStatus records the provider's latest payment status on an
+// order.
+func setOrderPaymentStatus(ctx context.Context, orderID, status string) error {
+	filter := bson.M{"_id": orderID, "payment": bson.M{"$ne": nil}}
+	update := bson.M{"$set": bson.M{"payment.status": status, "payment.updated_at": time.Now()}}
+	if _, err := db.OrderCollection.UpdateOne(ctx, filter, update); err != nil {
+		return &commitError{message: "Failed to update order payment", err: err}
+	}
+	return nil
+}
+
+// settleRefundPayment gives the money of refund back through the provider:
+// an uncaptured payment is voided, a captured one refunded. The outcome is
+// stored on the refund and the order. The refund is already recorded, so a
+// failure is kept as payment status "failed" rather than undoing it.
+func settleRefundPayment(ctx context.Context, refund *models.Refund, order *models.Order) {
+	pay := order.Payment
+	if pay == nil {
+		return
+	}
+
+	var result payment.Result
+	var err error
+	switch {
+	case refund.Type == models.RefundCancel && (pay.Status == payment.StatusAuthorized || pay.Status == payment.StatusPending):
+		result, err = Payments.Void(ctx, pay.PaymentID)
+	case refund.Amount > 0:
+		result, err = Payments.Refund(ctx, pay.PaymentID, refund.Amount)
+	default:
+		return
+	}
+
+	refund.PaymentStatus = result.Status
+	if err != nil {
+		log.Printf("payment for refund %s of order %s: %v", refund.ID, order.ID, err)
+		refund.PaymentStatus = paymentFailed
+	}
+	if _, err := db.RefundCollection.UpdateOne(ctx, bson.M{"_id": refund.ID}, bson.M{"$set": bson.M{"payment_status": refund.PaymentStatus}}); err != nil {
+		log.Printf("refund %s: %v", refund.ID, err)
+	}
+	if refund.PaymentStatus != paymentFailed {
+		pay.Status = refund.PaymentStatus
+		if err := setOrderPaymentStatus(ctx, order.ID, pay.Status); err != nil {
+			log.Printf("order %s: %v", order.ID, err)
+		}
+	}
+}
+
+// PaymentWebhook godoc
+// @Summary Receive payment provider events
+// @Description Called by the payment provider when a payment settles after the call that started it. The body must be signed with the webhook secret in the X-Payment-Signature header. An authorized payment is captured, a captured one marks its pending order paid if it captured the order's total, and a declined one cancels it.
+// @Tags Payments
+// @Accept json
+// @Produce json
+// @Param X-Payment-Signature header string true "HMAC-SHA256 of the body, hex encoded"
+// @Param event body payment.Event true "Payment event"
+// @Success 204
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /payments/webhook [post]
+func PaymentWebhook(c *fiber.Ctx) error {
+	event, err := Payments.ParseWebhook(c.Body(), c.Get(payment.SignatureHeader))
+	if errors.Is(err, payment.ErrInvalidSignature) {
+		return c.Status(fiber.StatusUnauthorized).JSON(ErrorResponse{Error: "Invalid signature"})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Error: "Invalid event"})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var order models.Order
+	err = db.OrderCollection.FindOne(ctx, bson.M{"payment.payment_id": event.PaymentID}).Decode(&order)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		// The provider retries, so an event that beats its checkout is not lost
+		return c.Status(fiber.StatusNotFound).JSON(ErrorResponse{Error: "Order not found"})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{Error: "Failed to fetch order"})
+	}
+
+	if err := applyPaymentEvent(ctx, order, event); err != nil {
+		return respondError(c, err)
+	}
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// applyPaymentEvent brings order in line with event, whether the webhook
+// reported it or reconcilePayments looked it up. An authorized payment is
+// captured, a captured one marks the pending order paid if it captured the
+// order's total, and a declined one cancels it. Errors are returned as
+// *fiber.Error or *commitError for respondError.
+func applyPaymentEvent(ctx context.Context, order models.Order, event payment.Event) error {
+	switch event.Status {
+	case payment.StatusAuthorized:
+		if order.Status == models.OrderPending {
+			if err := setOrderPaymentStatus(ctx, order.ID, payment.StatusAuthorized); err != nil {
+				return err
+			}
+			if _, err := captureOrderPayment(ctx, order.ID, event.PaymentID, order.Total); err != nil {
+				var fiberErr *fiber.Error
+				if !errors.As(err, &fiberErr) || fiberErr.Code != fiber.StatusPaymentRequired {
+					return err
+				}
+			}
+		}
+	case payment.StatusCaptured:
+		switch order.Status {
+		case models.OrderPending:
+			if event.Amount != order.Total {
+				log.Printf("capture of order %s was %s, expected %s", order.ID, event.Amount, order.Total)
+				return fiber.NewError(fiber.StatusConflict, "Captured amount does not match the order total")
+			}
+			set := bson.M{"payment.status": payment.StatusCaptured, "payment.updated_at": time.Now()}
+			if _, err := transitionOrder(ctx, order.ID, models.OrderPaid, set); err != nil {
+				return err
+			}
+		case models.OrderCancelled:
+			// Cancelled while the capture was in flight, so give the money back
+			if _, err := Payments.Refund(ctx, event.PaymentID, event.Amount); err != nil {
+				log.Printf("refund late capture of order %s: %v", order.ID, err)
+				return fiber.NewError(fiber.StatusBadGateway, "Failed to refund the capture")
+			}
+			if err := setOrderPaymentStatus(ctx, order.ID, payment.StatusRefunded); err != nil {
+				return err
+			}
+		}
+	case payment.StatusDeclined:
+		if order.Status == models.OrderPending {
+			if err := cancelOrderForPayment(ctx, order.ID, payment.StatusDeclined); err != nil {
+				return err
+			}
+		}
+	case payment.StatusVoided, payment.StatusRefunded:
+		if err := setOrderPaymentStatus(ctx, order.ID, event.Status); err != nil {
+			return err
+		}
+		if event.Status == payment.StatusRefunded {
+			filter := bson.M{"order_id": order.ID, "payment_status": payment.StatusPending}
+			update := bson.M{"$set": bson.M{"payment_status": payment.StatusRefunded}}
+			if _, err := db.RefundCollection.UpdateMany(ctx, filter, update); err != nil {
+				return &commitError{message: "Failed to update refunds", err: err}
+			}
+		}
+	}
+	return nil
+}
+
+// ReconcilePayments settles, every interval for as long as the process
+// runs, the pending orders whose provider has not answered for an interval:
+// captures that timed out and webhooks that never arrived.
+func ReconcilePayments(interval time.Duration) {
+	for range time.Tick(interval) {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		reconcilePayments(ctx, time.Now().Add(-interval))
+		cancel()
+	}
+}
+
+// reconcilePayments looks up the payment of every pending order last
+// updated by the provider before cutoff, and applies what the provider
+// reports as if its webhook had arrived.
+func reconcilePayments(ctx context.Context, cutoff time.Time) {
+	filter := bson.M{
+		"status":             models.OrderPending,
+		"payment.payment_id": bson.M{"$exists": true},
+		"payment.updated_at": bson.M{"$lte": cutoff},
+	}
+	cursor, err := db.OrderCollection.Find(ctx, filter)
+	var orders []models.Order
+	if err == nil {
+		err = cursor.All(ctx, &orders)
+	}
+	if err != nil {
+		log.Printf("reconcile payments: %v", err)
+		return
+	}
+	for _, order := range orders {
+		event, err := Payments.Lookup(ctx, order.Payment.PaymentID)
+		if err == nil {
+			err = applyPaymentEvent(ctx, order, event)
+		}
+		if err != nil {
+			log.Printf("reconcile payment of order %s: %v", order.ID, err)
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package handlers
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/faiisu/ecom-backend/internal/db"
+	"github.com/faiisu/ecom-backend/internal/models"
+	"github.com/faiisu/ecom-backend/internal/money"
+	"github.com/faiisu/ecom-backend/internal/payment"
+	"github.com/google/uuid"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// TestReconcileCaptureTimeout captures an order whose capture answer is lost,
+// which leaves it pending, and checks that reconciling marks it paid.
+func TestReconcileCaptureTimeout(t *testing.T) {
+	connectTestMongo(t)
+	provider := Payments
+	t.Cleanup(func() { Payments = provider })
+	fake := payment.NewFake("secret")
+	Payments = fake
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	total := money.FromMajor(250)
+	orderID := uuid.New().String()
+	pay, err := authorizePayment(ctx, orderID, "u1", total)
+	if err != nil {
+		t.Fatal(err)
+	}
+	created := time.Now().Add(-2 * time.Minute)
+	pay.UpdatedAt = created
+	order := models.Order{
+		ID:            orderID,
+		UserID:        "u1",
+		Status:        models.OrderPending,
+		Items:         []models.OrderItem{},
+		Campaigns:     []models.OrderCampaign{},
+		Total:         total,
+		Payment:       pay,
+		StatusHistory: []models.OrderStatusChange{{Status: models.OrderPending, At: created}},
+		CreatedAt:     created,
+		UpdatedAt:     created,
+	}
+	if _, err := db.OrderCollection.InsertOne(ctx, order); err != nil {
+		t.Fatal(err)
+	}
+
+	fake.Script(payment.OpCapture, payment.Timeout)
+	status, err := captureOrderPayment(ctx, orderID, pay.PaymentID, total)
+	if err != nil || status != models.OrderPending {
+		t.Fatalf("captureOrderPayment = %q, %v, want pending", status, err)
+	}
+
+	// Not yet due, so nothing changes
+	reconcilePayments(ctx, created.Add(-time.Minute))
+	if got := findTestOrder(ctx, t, orderID); got.Status != models.OrderPending {
+		t.Fatalf("order is %s before it was due, want pending", got.Status)
+	}
+
+	reconcilePayments(ctx, time.Now())
+	got := findTestOrder(ctx, t, orderID)
+	if got.Status != models.OrderPaid {
+		t.Errorf("order is %s, want paid", got.Status)
+	}
+	if got.Payment == nil || got.Payment.Status != payment.StatusCaptured {
+		t.Errorf("payment = %+v, want captured", got.Payment)
+	}
+}
+
+func findTestOrder(ctx context.Context, t *testing.T, id string) models.Order {
+	t.Helper()
+	var order models.Order
+	if err := db.OrderCollection.FindOne(ctx, bson.M{"_id": id}).Decode(&order); err != nil {
+		t.Fatal(err)
+	}
+	return order
+}
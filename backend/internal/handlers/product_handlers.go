@@ -7,6 +7,7 @@ import (
 
 	"github.com/faiisu/ecom-backend/internal/db"
 	"github.com/faiisu/ecom-backend/internal/models"
+	"github.com/faiisu/ecom-backend/internal/money"
 	"github.com/gofiber/fiber/v2"
 	"github.com/google/uuid"
 	"go.mongodb.org/mongo-driver/bson"
@@ -14,10 +15,12 @@ import (
 )
 
 type RegisterProduct struct {
-	Name              string  `json:"name"`
-	Description       string  `json:"description"`
-	ProductCategoryID string  `json:"product_category_id"`
-	Price             float64 `json:"price"`
+	Name              string      `json:"name"`
+	Description       string      `json:"description"`
+	ProductCategoryID string      `json:"product_category_id"`
+	Price             money.Money `json:"price"`
+	Stock             *int        `json:"stock,omitempty"` // leave out to not track stock
+	WeightGrams       int         `json:"weight_grams"`    // used by weight-based shipping rates
 }
 
 // AddProduct godoc
@@ -40,6 +43,12 @@ func AddProduct(c *fiber.Ctx) error {
 	if req.Name == "" || req.ProductCategoryID == "" || req.Price <= 0 {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Incomplete product details"})
 	}
+	if req.Stock != nil && *req.Stock < 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Error: "stock cannot be negative"})
+	}
+	if req.WeightGrams < 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Error: "weight_grams cannot be negative"})
+	}
 
 	product := models.Product{
 		ID:                uuid.New().String(),
@@ -48,6 +57,8 @@ func AddProduct(c *fiber.Ctx) error {
 		ProductCategoryID: req.ProductCategoryID,
 		Price:             req.Price,
 		IsActive:          true,
+		Stock:             req.Stock,
+		WeightGrams:       req.WeightGrams,
 		CreatedAt:         time.Now(),
 	}
 
@@ -69,6 +80,12 @@ func AddProduct(c *fiber.Ctx) error {
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{Error: "Failed to create product"})
 	}
+	if product.Stock != nil {
+		movement := models.StockMovement{ProductID: product.ID, Type: models.StockInitial, Change: *product.Stock}
+		if err := logStockMovement(ctx, movement); err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{Error: "Failed to log stock movement"})
+		}
+	}
 
 	return c.JSON(fiber.Map{"status": "product added"})
 }
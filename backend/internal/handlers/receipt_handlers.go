@@ -0,0 +1,136 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/faiisu/ecom-backend/internal/db"
+	"github.com/faiisu/ecom-backend/internal/models"
+	"github.com/faiisu/ecom-backend/internal/receipt"
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// errInvoiceNumberTaken aborts an invoice number allocation that lost the
+// race to a concurrent request for the same order.
+var errInvoiceNumberTaken = errors.New("order already has an invoice number")
+
+// GetOrderReceipt godoc
+// @Summary Download an order receipt
+// @Description Renders the receipt of a paid order from its stored snapshot, as a PDF (default) or an HTML page. The first receipt gives the order the next sequential invoice number; later ones reuse it.
+// @Tags Orders
+// @Produce application/pdf
+// @Produce text/html
+// @Param id path string true "Order ID"
+// @Param format query string false "pdf or html; without it the Accept header decides" Enums(pdf, html)
+// @Success 200 {file} file
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /orders/{id}/receipt [get]
+func GetOrderReceipt(c *fiber.Ctx) error {
+	format := c.Query("format")
+	if format == "" {
+		format = "pdf"
+		if c.Accepts(fiber.MIMETextHTML, "application/pdf") == fiber.MIMETextHTML {
+			format = "html"
+		}
+	}
+	if format != "pdf" && format != "html" {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Error: "format must be pdf or html"})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var order models.Order
+	err := db.OrderCollection.FindOne(ctx, bson.M{"_id": c.Params("id")}).Decode(&order)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return c.Status(fiber.StatusNotFound).JSON(ErrorResponse{Error: "Order not found"})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{Error: "Failed to fetch order"})
+	}
+	if !wasPaid(order) {
+		return c.Status(fiber.StatusConflict).JSON(ErrorResponse{Error: "A receipt is only available once the order is paid"})
+	}
+
+	if order.InvoiceNumber == "" {
+		order.InvoiceNumber, err = assignInvoiceNumber(ctx, order.ID)
+		if err != nil {
+			return respondError(c, err)
+		}
+	}
+
+	var buf bytes.Buffer
+	r := receipt.New(order, Taxes.Default)
+	if format == "html" {
+		err = receipt.WriteHTML(&buf, r)
+		c.Set(fiber.HeaderContentType, fiber.MIMETextHTMLCharsetUTF8)
+	} else {
+		err = receipt.WritePDF(&buf, r)
+		c.Set(fiber.HeaderContentType, "application/pdf")
+		c.Set(fiber.HeaderContentDisposition, fmt.Sprintf(`attachment; filename="receipt-%s.pdf"`, order.InvoiceNumber))
+	}
+	if err != nil {
+		c.Set(fiber.HeaderContentDisposition, "")
+		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{Error: "Failed to render receipt"})
+	}
+
+	return c.Send(buf.Bytes())
+}
+
+// wasPaid reports whether order ever reached paid, so refunded and
+// cancelled-after-payment orders still get a receipt. Legacy orders were
+// all paid, whatever history they were migrated with.
+func wasPaid(order models.Order) bool {
+	if order.Legacy {
+		return true
+	}
+	for _, change := range order.StatusHistory {
+		if change.Status == models.OrderPaid {
+			return true
+		}
+	}
+	return false
+}
+
+// assignInvoiceNumber gives order id the next invoice number and returns the
+// number the order ends up with. The counter and the order change in one
+// transaction, so a request that loses the race rolls its increment back and
+// numbers stay gapless. Without transactions a lost race skips a number.
+func assignInvoiceNumber(ctx context.Context, id string) (string, error) {
+	var number string
+	err := db.WithTransaction(ctx, func(txCtx context.Context) error {
+		seq, err := db.NextSequence(txCtx, "invoice")
+		if err != nil {
+			return &commitError{message: "Failed to allocate invoice number", err: err}
+		}
+		number = fmt.Sprintf("INV-%06d", seq)
+
+		filter := bson.M{"_id": id, "invoice_number": bson.M{"$exists": false}}
+		update := bson.M{"$set": bson.M{"invoice_number": number}}
+		result, err := db.OrderCollection.UpdateOne(txCtx, filter, update)
+		if err != nil {
+			return &commitError{message: "Failed to save invoice number", err: err}
+		}
+		if result.MatchedCount == 0 {
+			return errInvoiceNumberTaken
+		}
+		return nil
+	})
+	if !errors.Is(err, errInvoiceNumberTaken) {
+		return number, err
+	}
+
+	var order models.Order
+	if err := db.OrderCollection.FindOne(ctx, bson.M{"_id": id}).Decode(&order); err != nil {
+		return "", fiber.NewError(fiber.StatusInternalServerError, "Failed to fetch order")
+	}
+	return order.InvoiceNumber, nil
+}
@@ -0,0 +1,335 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/faiisu/ecom-backend/internal/db"
+	"github.com/faiisu/ecom-backend/internal/models"
+	"github.com/faiisu/ecom-backend/internal/pricing"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type CancelOrderRequest struct {
+	Reason string `json:"reason"`
+}
+
+type RefundOrderRequest struct {
+	Items  []models.RefundItem `json:"items"` // empty refunds everything not refunded yet
+	Reason string              `json:"reason"`
+}
+
+type OrderRefundResponse struct {
+	Refund models.Refund `json:"refund"`
+	Order  models.Order  `json:"order"`
+}
+
+// CancelOrder godoc
+// @Summary Cancel an order
+// @Description Cancels a pending or paid order. Everything not refunded yet is given back through the payment provider, an uncaptured payment is voided, the redeemed points are returned to the user and the items are put back in stock. Legacy orders cannot be cancelled.
+// @Tags Orders
+// @Accept json
+// @Produce json
+// @Param id path string true "Order ID"
+// @Param body body CancelOrderRequest false "Optional reason"
+// @Success 200 {object} OrderRefundResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /orders/{id}/cancel [post]
+func CancelOrder(c *fiber.Ctx) error {
+	var req CancelOrderRequest
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&req); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Error: "Invalid request body"})
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var resp OrderRefundResponse
+	err := db.WithTransaction(ctx, func(txCtx context.Context) error {
+		var err error
+		resp.Refund, resp.Order, err = refundOrder(txCtx, c.Params("id"), models.RefundCancel, nil, req.Reason)
+		return err
+	})
+	if err != nil {
+		return respondError(c, err)
+	}
+	settleRefundPayment(ctx, &resp.Refund, &resp.Order)
+
+	return c.JSON(resp)
+}
+
+// RefundOrder godoc
+// @Summary Refund an order
+// @Description Refunds some or all items of a paid or fulfilled order. The rest of the order is priced again with its original campaigns, so the refund is what was paid minus what the kept items now cost, and points the kept items no longer redeem are returned. Refunding the last items moves the order to refunded. Legacy orders cannot be refunded.
+// @Tags Orders
+// @Accept json
+// @Produce json
+// @Param id path string true "Order ID"
+// @Param body body RefundOrderRequest false "Items to refund, none for a full refund"
+// @Success 200 {object} OrderRefundResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /orders/{id}/refunds [post]
+func RefundOrder(c *fiber.Ctx) error {
+	var req RefundOrderRequest
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&req); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Error: "Invalid request body"})
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var resp OrderRefundResponse
+	err := db.WithTransaction(ctx, func(txCtx context.Context) error {
+		var err error
+		resp.Refund, resp.Order, err = refundOrder(txCtx, c.Params("id"), models.RefundPartial, req.Items, req.Reason)
+		return err
+	})
+	if err != nil {
+		return respondError(c, err)
+	}
+	settleRefundPayment(ctx, &resp.Refund, &resp.Order)
+
+	return c.JSON(resp)
+}
+
+// GetOrderRefunds godoc
+// @Summary List an order's refunds
+// @Description Oldest first
+// @Tags Orders
+// @Accept json
+// @Produce json
+// @Param id path string true "Order ID"
+// @Success 200 {array} models.Refund
+// @Failure 500 {object} ErrorResponse
+// @Router /orders/{id}/refunds [get]
+func GetOrderRefunds(c *fiber.Ctx) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}})
+	cursor, err := db.RefundCollection.Find(ctx, bson.M{"order_id": c.Params("id")}, opts)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{Error: "Failed to fetch refunds"})
+	}
+	defer cursor.Close(ctx)
+
+	refunds := []models.Refund{}
+	if err = cursor.All(ctx, &refunds); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{Error: "Failed to decode refunds"})
+	}
+
+	return c.JSON(refunds)
+}
+
+// refundOrder gives back items of order id, or all of them for a cancellation
+// or an empty items list, and returns the refund and the updated order. Run
+// it through db.WithTransaction so the order, the user's points and the
+// refund record change together.
+func refundOrder(ctx context.Context, id, kind string, items []models.RefundItem, reason string) (models.Refund, models.Order, error) {
+	var order models.Order
+	err := db.OrderCollection.FindOne(ctx, bson.M{"_id": id}).Decode(&order)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return models.Refund{}, order, fiber.NewError(fiber.StatusNotFound, "Order not found")
+	}
+	if err != nil {
+		return models.Refund{}, order, &commitError{message: "Failed to fetch order", err: err}
+	}
+	if order.Legacy {
+		// Its items and total were made up from the current catalog
+		return models.Refund{}, order, fiber.NewError(fiber.StatusConflict, "Legacy orders cannot be cancelled or refunded")
+	}
+
+	from := order.Status
+	if kind == models.RefundCancel {
+		if !models.CanTransitionOrder(from, models.OrderCancelled) {
+			return models.Refund{}, order, fiber.NewError(fiber.StatusConflict, "A "+from+" order cannot be cancelled")
+		}
+	} else if from != models.OrderPaid && from != models.OrderFulfilled {
+		return models.Refund{}, order, fiber.NewError(fiber.StatusConflict, "A "+from+" order cannot be refunded")
+	}
+
+	// What the customer still holds, and how much of it comes back now
+	keep := make(map[string]int, len(order.Items))
+	for _, item := range order.Items {
+		keep[item.ProductID] += item.Quantity - item.RefundedQuantity
+	}
+	refunded := make(map[string]int, len(order.Items))
+	if len(items) == 0 {
+		for productID, quantity := range keep {
+			if quantity > 0 {
+				refunded[productID] = quantity
+			}
+		}
+	} else {
+		for _, item := range items {
+			if item.Quantity <= 0 {
+				return models.Refund{}, order, fiber.NewError(fiber.StatusBadRequest, "quantity must be positive")
+			}
+			if _, ok := keep[item.ProductID]; !ok {
+				return models.Refund{}, order, fiber.NewError(fiber.StatusBadRequest, "Product "+item.ProductID+" is not in this order")
+			}
+			refunded[item.ProductID] += item.Quantity
+			if refunded[item.ProductID] > keep[item.ProductID] {
+				return models.Refund{}, order, fiber.NewError(fiber.StatusConflict, "More of product "+item.ProductID+" than is left to refund")
+			}
+		}
+	}
+	if len(refunded) == 0 {
+		return models.Refund{}, order, fiber.NewError(fiber.StatusConflict, "Nothing left to refund")
+	}
+	refundItems := make([]models.RefundItem, 0, len(refunded))
+	for _, item := range order.Items {
+		if quantity, ok := refunded[item.ProductID]; ok && !containsRefundItem(refundItems, item.ProductID) {
+			refundItems = append(refundItems, models.RefundItem{ProductID: item.ProductID, Quantity: quantity})
+		}
+	}
+
+	full := true
+	for productID := range keep {
+		keep[productID] -= refunded[productID]
+		if keep[productID] > 0 {
+			full = false
+		}
+	}
+	if full && kind == models.RefundPartial {
+		kind = models.RefundFull
+	}
+
+	// Price what is kept with the order's own campaigns. The difference to
+	// what is still held is the refund.
+	repriced, err := pricing.RepriceOrder(order, keep)
+	if err != nil {
+		return models.Refund{}, order, fiber.NewError(fiber.StatusInternalServerError, "Failed to price the remaining items")
+	}
+	amount := order.Total - order.RefundedTotal - repriced.Total
+	if amount < 0 || from == models.OrderPending {
+		amount = 0 // nothing was collected for a pending order
+	}
+	points := order.PointUsed - order.PointRefunded - repriced.PointUsed
+	if points < 0 {
+		points = 0
+	}
+
+	now := time.Now()
+	previousUpdate := order.UpdatedAt
+	for i, item := range order.Items {
+		take := refunded[item.ProductID]
+		if left := item.Quantity - item.RefundedQuantity; take > left {
+			take = left
+		}
+		order.Items[i].RefundedQuantity += take
+		refunded[item.ProductID] -= take
+	}
+	order.RefundedTotal += amount
+	order.PointRefunded += points
+	order.UpdatedAt = now
+
+	set := bson.M{
+		"items":          order.Items,
+		"refunded_total": order.RefundedTotal,
+		"point_refunded": order.PointRefunded,
+		"updated_at":     now,
+	}
+	update := bson.M{"$set": set}
+	status := ""
+	switch {
+	case kind == models.RefundCancel:
+		status = models.OrderCancelled
+	case full:
+		status = models.OrderRefunded
+	}
+	if status != "" {
+		if err := order.Transition(status, now); err != nil {
+			return models.Refund{}, order, fiber.NewError(fiber.StatusConflict, "Order cannot move from "+from+" to "+status)
+		}
+		set["status"] = status
+		update["$push"] = bson.M{"status_history": models.OrderStatusChange{Status: status, At: now}}
+	}
+
+	// Only matches while the order is as it was read, so the same items
+	// cannot be refunded twice by concurrent requests
+	filter := bson.M{"_id": id, "status": from, "updated_at": previousUpdate}
+	result, err := db.OrderCollection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return models.Refund{}, order, &commitError{message: "Failed to update order", err: err}
+	}
+	if result.MatchedCount == 0 {
+		return models.Refund{}, order, fiber.NewError(fiber.StatusConflict, "Order changed, try again")
+	}
+
+	// A cancelled order was never shipped, so its items go back on the shelf.
+	// Refunded items only come back through a stock adjustment.
+	if kind == models.RefundCancel {
+		for _, item := range refundItems {
+			tracked, err := putStock(ctx, item.ProductID, item.Quantity)
+			if err != nil {
+				return models.Refund{}, order, err
+			}
+			if !tracked {
+				continue
+			}
+			if err := logStockMovement(ctx, models.StockMovement{
+				ProductID: item.ProductID,
+				Type:      models.StockRestock,
+				Change:    item.Quantity,
+				OrderID:   order.ID,
+				UserID:    order.UserID,
+			}); err != nil {
+				return models.Refund{}, order, err
+			}
+		}
+	}
+
+	// Return the points that are no longer redeemed
+	if points > 0 {
+		result, err := db.UserCollection.UpdateOne(ctx, bson.M{"_id": order.UserID}, bson.M{"$inc": bson.M{"point": points}})
+		if err != nil {
+			return models.Refund{}, order, &commitError{message: "Failed to restore user points", err: err}
+		}
+		if result.MatchedCount == 0 {
+			return models.Refund{}, order, fiber.NewError(fiber.StatusNotFound, "User not found, points cannot be restored")
+		}
+	}
+
+	refund := models.Refund{
+		ID:            uuid.New().String(),
+		OrderID:       order.ID,
+		HistoryID:     order.ID,
+		UserID:        order.UserID,
+		Type:          kind,
+		Items:         refundItems,
+		Amount:        amount,
+		PointRefunded: points,
+		Reason:        reason,
+		CreatedAt:     now,
+	}
+	if _, err := db.RefundCollection.InsertOne(ctx, refund); err != nil {
+		return models.Refund{}, order, &commitError{message: "Failed to create refund", err: err}
+	}
+
+	return refund, order, nil
+}
+
+func containsRefundItem(items []models.RefundItem, productID string) bool {
+	for _, item := range items {
+		if item.ProductID == productID {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,20 @@
+package models
+
+import "time"
+
+// Address is a saved shipping address. Each user has at most one default,
+// which is the first address they add until they pick another.
+type Address struct {
+	ID         string    `json:"id" bson:"_id,omitempty"`
+	UserID     string    `json:"user_id" bson:"user_id"`
+	Recipient  string    `json:"recipient" bson:"recipient"`
+	Phone      string    `json:"phone" bson:"phone"`
+	Line1      string    `json:"line1" bson:"line1"`
+	Line2      string    `json:"line2,omitempty" bson:"line2,omitempty"`
+	District   string    `json:"district,omitempty" bson:"district,omitempty"`
+	Province   string    `json:"province" bson:"province"`
+	PostalCode string    `json:"postal_code" bson:"postal_code"`
+	Country    string    `json:"country" bson:"country"`
+	IsDefault  bool      `json:"is_default" bson:"is_default"`
+	CreatedAt  time.Time `json:"created_at" bson:"created_at"`
+}
@@ -1,14 +1,17 @@
 package models
 
+import "github.com/faiisu/ecom-backend/internal/money"
+
 type Campaign struct {
 	ID                 string            `json:"id" bson:"_id,omitempty"`
 	Name               string            `json:"name" bson:"name"`
 	Description        string            `json:"description,omitempty" bson:"description,omitempty"`
-	DiscountType       string            `json:"discount_type" bson:"discount_type"` // "percent", "fixed", "point", "spendAndSave"
-	DiscountValue      float64           `json:"discount_value" bson:"discount_value"`
-	Limit              float64           `json:"limit" bson:"limit"`
-	Every              float64           `json:"every" bson:"every"`
+	DiscountType       string            `json:"discount_type" bson:"discount_type"`   // "percent", "fixed", "point", "spendAndSave"
+	DiscountValue      money.Money       `json:"discount_value" bson:"discount_value"` // a percentage for "percent" campaigns
+	Limit              money.Money       `json:"limit" bson:"limit"`                   // a percentage for "point" campaigns
+	Every              money.Money       `json:"every" bson:"every"`
 	CampaignCategoryID string            `json:"campaign_category_id" bson:"campaign_category_id"`
+	ShippingScope      string            `json:"shipping_scope,omitempty" bson:"shipping_scope,omitempty"` // "", "include" or "only": whether the shipping fee is discounted
 	IsActive           bool              `json:"is_active" bson:"is_active"`
 	ProductCategories  []ProductCategory `json:"product_categories" bson:"product_categories"`
 }
@@ -19,8 +22,9 @@ type CampaignTargetCategory struct {
 }
 
 type CampaignsCategories struct {
-	ID          string `json:"id" bson:"_id,omitempty"`
-	Name        string `json:"name" bson:"name"`
-	Description string `json:"description" bson:"description"`
-	Rank        int    `json:"rank" bson:"rank"`
+	ID            string `json:"id" bson:"_id,omitempty"`
+	Name          string `json:"name" bson:"name"`
+	Description   string `json:"description" bson:"description"`
+	Rank          int    `json:"rank" bson:"rank"`
+	AllowMultiple bool   `json:"allow_multiple" bson:"allow_multiple"` // false: at most one campaign of this category per checkout
 }
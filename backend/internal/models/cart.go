@@ -1,13 +1,23 @@
 package models
 
+import (
+	"time"
+
+	"github.com/faiisu/ecom-backend/internal/money"
+)
+
 type CartItem struct {
-	ID        string `json:"id" bson:"_id,omitempty"`
-	UserID    string `json:"user_id" bson:"user_id"`
-	ProductID string `json:"product_id" bson:"product_id"`
-	Quantity  int    `json:"quantity" bson:"quantity"`
+	ID        string      `json:"id" bson:"_id,omitempty"`
+	UserID    string      `json:"user_id" bson:"user_id"`
+	ProductID string      `json:"product_id" bson:"product_id"`
+	Quantity  int         `json:"quantity" bson:"quantity"`
+	UnitPrice money.Money `json:"unit_price" bson:"unit_price"` // product price when the line was last added to or set
 }
 
+// CartCampaign is a campaign the user attached to their cart. Checkout uses
+// the attached campaigns unless it is sent its own selection.
 type CartCampaign struct {
-	UserID     string `json:"user_id" bson:"user_id"`
-	CampaignID string `json:"campaign_id" bson:"campaign_id"`
+	UserID     string    `json:"user_id" bson:"user_id"`
+	CampaignID string    `json:"campaign_id" bson:"campaign_id"`
+	AttachedAt time.Time `json:"attached_at" bson:"attached_at"`
 }
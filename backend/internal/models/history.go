@@ -1,6 +1,10 @@
 package models
 
-import "time"
+import (
+	"time"
+
+	"github.com/faiisu/ecom-backend/internal/money"
+)
 
 type TransactionHistory struct {
 	ID        string    `json:"id" bson:"_id,omitempty"`
@@ -9,12 +13,27 @@ type TransactionHistory struct {
 	Date      time.Time `json:"date" bson:"date"`
 }
 
+// TransactionHistoryProduct is a purchased line, with the product details and
+// prices as they were at checkout.
 type TransactionHistoryProduct struct {
-	HistoryID string `json:"history_id" bson:"history_id"`
-	ProductID string `json:"product_id" bson:"product_id"`
+	HistoryID           string      `json:"history_id" bson:"history_id"`
+	ProductID           string      `json:"product_id" bson:"product_id"`
+	ProductName         string      `json:"product_name" bson:"product_name"`
+	ProductCategoryID   string      `json:"product_category_id" bson:"product_category_id"`
+	ProductCategoryName string      `json:"product_category_name" bson:"product_category_name"`
+	UnitPrice           money.Money `json:"unit_price" bson:"unit_price"`
+	Quantity            int         `json:"quantity" bson:"quantity"`
+	Discount            money.Money `json:"discount" bson:"discount"`
+	Total               money.Money `json:"total" bson:"total"`
 }
 
+// TransactionHistoryCampaign is a campaign applied at checkout, with its
+// terms and the amount it saved at that time.
 type TransactionHistoryCampaign struct {
-	HistoryID  string `json:"history_id" bson:"history_id"`
-	CampaignID string `json:"campaign_id" bson:"campaign_id"`
+	HistoryID     string      `json:"history_id" bson:"history_id"`
+	CampaignID    string      `json:"campaign_id" bson:"campaign_id"`
+	Name          string      `json:"name" bson:"name"`
+	DiscountType  string      `json:"discount_type" bson:"discount_type"`
+	DiscountValue money.Money `json:"discount_value" bson:"discount_value"`
+	Amount        money.Money `json:"amount" bson:"amount"`
 }
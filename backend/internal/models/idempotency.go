@@ -0,0 +1,16 @@
+package models
+
+import "time"
+
+// IdempotencyKey records a request made with an Idempotency-Key header and,
+// once it has finished, the response to replay for retries.
+type IdempotencyKey struct {
+	Key            string    `json:"key" bson:"_id"`
+	RequestHash    string    `json:"request_hash" bson:"request_hash"`
+	Status         string    `json:"status" bson:"status"`     // "processing", "completed"
+	Deadline       time.Time `json:"deadline" bson:"deadline"` // when a request still processing is taken to have died
+	ResponseStatus int       `json:"response_status" bson:"response_status"`
+	ResponseBody   []byte    `json:"response_body" bson:"response_body"`
+	CreatedAt      time.Time `json:"created_at" bson:"created_at"`
+	ExpiresAt      time.Time `json:"expires_at" bson:"expires_at"`
+}
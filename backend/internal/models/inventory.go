@@ -0,0 +1,39 @@
+package models
+
+import "time"
+
+// Stock movement types.
+const (
+	StockInitial    = "initial"    // stock set when the product was created
+	StockAdjustment = "adjustment" // changed by an admin
+	StockReserve    = "reserve"    // held for a user in checkout
+	StockRelease    = "release"    // a reservation returned unused
+	StockSale       = "sale"       // taken by a checkout
+	StockRestock    = "restock"    // returned by a cancelled order
+)
+
+// StockMovement is one change to a product's stock. Change is negative when
+// stock goes out.
+type StockMovement struct {
+	ID            string    `json:"id" bson:"_id"`
+	ProductID     string    `json:"product_id" bson:"product_id"`
+	Type          string    `json:"type" bson:"type"`
+	Change        int       `json:"change" bson:"change"`
+	Reason        string    `json:"reason,omitempty" bson:"reason,omitempty"`
+	OrderID       string    `json:"order_id,omitempty" bson:"order_id,omitempty"`
+	UserID        string    `json:"user_id,omitempty" bson:"user_id,omitempty"`
+	ReservationID string    `json:"reservation_id,omitempty" bson:"reservation_id,omitempty"`
+	CreatedAt     time.Time `json:"created_at" bson:"created_at"`
+}
+
+// StockReservation holds stock of a product for a user in checkout. The
+// stock is taken when the reservation is made, and given back if the
+// reservation expires before checkout uses it.
+type StockReservation struct {
+	ID        string    `json:"id" bson:"_id"`
+	UserID    string    `json:"user_id" bson:"user_id"`
+	ProductID string    `json:"product_id" bson:"product_id"`
+	Quantity  int       `json:"quantity" bson:"quantity"`
+	ExpiresAt time.Time `json:"expires_at" bson:"expires_at"`
+	CreatedAt time.Time `json:"created_at" bson:"created_at"`
+}
@@ -0,0 +1,158 @@
+package models
+
+import (
+	"errors"
+	"time"
+
+	"github.com/faiisu/ecom-backend/internal/money"
+)
+
+// Order statuses. An order moves forward along
+//
+//	pending -> paid -> fulfilled
+//
+// and can leave that path as cancelled (before fulfilment) or refunded
+// (after payment). Cancelled and refunded are final.
+const (
+	OrderPending   = "pending"
+	OrderPaid      = "paid"
+	OrderFulfilled = "fulfilled"
+	OrderCancelled = "cancelled"
+	OrderRefunded  = "refunded"
+)
+
+var ErrInvalidOrderTransition = errors.New("invalid order status transition")
+
+// orderTransitions lists the statuses each status may move to.
+var orderTransitions = map[string][]string{
+	OrderPending:   {OrderPaid, OrderCancelled},
+	OrderPaid:      {OrderFulfilled, OrderCancelled, OrderRefunded},
+	OrderFulfilled: {OrderRefunded},
+}
+
+// Order is a completed checkout. Its ID is the ID of the TransactionHistory
+// row written by the same checkout, and it keeps a snapshot of what was
+// bought and how it was priced.
+type Order struct {
+	ID               string              `json:"id" bson:"_id"`
+	UserID           string              `json:"user_id" bson:"user_id"`
+	Status           string              `json:"status" bson:"status"`
+	Items            []OrderItem         `json:"items" bson:"items"`
+	Campaigns        []OrderCampaign     `json:"campaigns" bson:"campaigns"`
+	Subtotal         money.Money         `json:"subtotal" bson:"subtotal"` // items only
+	ShippingFee      money.Money         `json:"shipping_fee" bson:"shipping_fee"`
+	ShippingDiscount money.Money         `json:"shipping_discount" bson:"shipping_discount"` // the part of Discount taken off ShippingFee
+	Discount         money.Money         `json:"discount" bson:"discount"`                   // campaigns and points together
+	PointUsed        int                 `json:"point_used" bson:"point_used"`
+	PointDiscount    money.Money         `json:"point_discount" bson:"point_discount"`
+	TaxMode          string              `json:"tax_mode,omitempty" bson:"tax_mode,omitempty"` // empty for orders placed before tax was stored
+	Tax              money.Money         `json:"tax" bson:"tax"`                               // included in Total, or added to it when TaxMode is exclusive
+	ShippingTaxRate  money.Money         `json:"shipping_tax_rate" bson:"shipping_tax_rate"`
+	ShippingTax      money.Money         `json:"shipping_tax" bson:"shipping_tax"`
+	Total            money.Money         `json:"total" bson:"total"`
+	RefundedTotal    money.Money         `json:"refunded_total" bson:"refunded_total"`
+	PointRefunded    int                 `json:"point_refunded" bson:"point_refunded"`
+	ShippingAddress  *Address            `json:"shipping_address,omitempty" bson:"shipping_address,omitempty"` // nil when nothing is shipped
+	Payment          *OrderPayment       `json:"payment,omitempty" bson:"payment,omitempty"`                   // nil when nothing was charged
+	InvoiceNumber    string              `json:"invoice_number,omitempty" bson:"invoice_number,omitempty"`     // set when the first receipt is issued
+	StatusHistory    []OrderStatusChange `json:"status_history" bson:"status_history"`
+	Legacy           bool                `json:"legacy,omitempty" bson:"legacy,omitempty"` // rebuilt from history rows that had no prices or quantities
+	CreatedAt        time.Time           `json:"created_at" bson:"created_at"`
+	UpdatedAt        time.Time           `json:"updated_at" bson:"updated_at"`
+}
+
+type OrderItem struct {
+	ProductID           string      `json:"product_id" bson:"product_id"`
+	ProductName         string      `json:"product_name" bson:"product_name"`
+	ProductCategoryID   string      `json:"product_category_id" bson:"product_category_id"`
+	ProductCategoryName string      `json:"product_category_name" bson:"product_category_name"`
+	UnitPrice           money.Money `json:"unit_price" bson:"unit_price"`
+	Quantity            int         `json:"quantity" bson:"quantity"`
+	LineTotal           money.Money `json:"line_total" bson:"line_total"`
+	Discount            money.Money `json:"discount" bson:"discount"`
+	Total               money.Money `json:"total" bson:"total"`
+	TaxRate             money.Money `json:"tax_rate" bson:"tax_rate"`
+	Tax                 money.Money `json:"tax" bson:"tax"`
+	RefundedQuantity    int         `json:"refunded_quantity" bson:"refunded_quantity"`
+}
+
+// OrderCampaign is an applied campaign, in the order it was applied, with
+// the terms needed to price the order again for a partial refund.
+type OrderCampaign struct {
+	CampaignID         string      `json:"campaign_id" bson:"campaign_id"`
+	Name               string      `json:"name" bson:"name"`
+	DiscountType       string      `json:"discount_type" bson:"discount_type"`
+	DiscountValue      money.Money `json:"discount_value" bson:"discount_value"`
+	Limit              money.Money `json:"limit" bson:"limit"`
+	Every              money.Money `json:"every" bson:"every"`
+	CampaignCategoryID string      `json:"campaign_category_id" bson:"campaign_category_id"`
+	ProductCategoryIDs []string    `json:"product_category_ids" bson:"product_category_ids"`
+	ShippingScope      string      `json:"shipping_scope,omitempty" bson:"shipping_scope,omitempty"`
+	Amount             money.Money `json:"amount" bson:"amount"`
+}
+
+// OrderPayment is the order's payment at the provider. Status is the last
+// payment status the provider reported.
+type OrderPayment struct {
+	Provider  string      `json:"provider" bson:"provider"`
+	PaymentID string      `json:"payment_id" bson:"payment_id"`
+	Status    string      `json:"status" bson:"status"`
+	Amount    money.Money `json:"amount" bson:"amount"`
+	UpdatedAt time.Time   `json:"updated_at" bson:"updated_at"`
+}
+
+// OrderStatusChange records when an order entered a status.
+type OrderStatusChange struct {
+	Status string    `json:"status" bson:"status"`
+	At     time.Time `json:"at" bson:"at"`
+}
+
+// CanTransitionOrder reports whether an order may move from one status to another.
+func CanTransitionOrder(from, to string) bool {
+	for _, next := range orderTransitions[from] {
+		if next == to {
+			return true
+		}
+	}
+	return false
+}
+
+// Transition moves the order to status at the given time and records the
+// change, or returns ErrInvalidOrderTransition.
+func (o *Order) Transition(status string, at time.Time) error {
+	if !CanTransitionOrder(o.Status, status) {
+		return ErrInvalidOrderTransition
+	}
+	o.Status = status
+	o.UpdatedAt = at
+	o.StatusHistory = append(o.StatusHistory, OrderStatusChange{Status: status, At: at})
+	return nil
+}
+
+// Refund types.
+const (
+	RefundCancel  = "cancel"
+	RefundPartial = "partial"
+	RefundFull    = "full"
+)
+
+// Refund records money and points given back for an order, linked to the
+// TransactionHistory row the checkout wrote.
+type Refund struct {
+	ID            string       `json:"id" bson:"_id"`
+	OrderID       string       `json:"order_id" bson:"order_id"`
+	HistoryID     string       `json:"history_id" bson:"history_id"`
+	UserID        string       `json:"user_id" bson:"user_id"`
+	Type          string       `json:"type" bson:"type"`
+	Items         []RefundItem `json:"items" bson:"items"`
+	Amount        money.Money  `json:"amount" bson:"amount"`
+	PointRefunded int          `json:"point_refunded" bson:"point_refunded"`
+	PaymentStatus string       `json:"payment_status,omitempty" bson:"payment_status,omitempty"` // the provider's answer to the refund or void
+	Reason        string       `json:"reason,omitempty" bson:"reason,omitempty"`
+	CreatedAt     time.Time    `json:"created_at" bson:"created_at"`
+}
+
+type RefundItem struct {
+	ProductID string `json:"product_id" bson:"product_id"`
+	Quantity  int    `json:"quantity" bson:"quantity"`
+}
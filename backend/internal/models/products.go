@@ -1,16 +1,22 @@
 package models
 
-import "time"
+import (
+	"time"
+
+	"github.com/faiisu/ecom-backend/internal/money"
+)
 
 type Product struct {
-	ID                  string    `json:"id" bson:"_id,omitempty"`
-	Name                string    `json:"name" bson:"name"`
-	Description         string    `json:"description,omitempty" bson:"description,omitempty"`
-	ProductCategoryID   string    `json:"product_category_id" bson:"product_category_id"`
-	ProductCategoryName string    `json:"product_category_name" bson:"product_category_name"`
-	Price               float64   `json:"price" bson:"price"`
-	IsActive            bool      `json:"is_active" bson:"is_active"`
-	CreatedAt           time.Time `json:"created_at" bson:"created_at"`
+	ID                  string      `json:"id" bson:"_id,omitempty"`
+	Name                string      `json:"name" bson:"name"`
+	Description         string      `json:"description,omitempty" bson:"description,omitempty"`
+	ProductCategoryID   string      `json:"product_category_id" bson:"product_category_id"`
+	ProductCategoryName string      `json:"product_category_name" bson:"product_category_name"`
+	Price               money.Money `json:"price" bson:"price"`
+	IsActive            bool        `json:"is_active" bson:"is_active"`
+	Stock               *int        `json:"stock,omitempty" bson:"stock,omitempty"` // units available, nil when stock is not tracked
+	WeightGrams         int         `json:"weight_grams,omitempty" bson:"weight_grams,omitempty"`
+	CreatedAt           time.Time   `json:"created_at" bson:"created_at"`
 }
 
 type ProductCategory struct {
@@ -15,4 +15,5 @@ type User struct {
 	IsGuest       bool      `json:"is_guest" bson:"is_guest"`
 	CreatedAt     time.Time `json:"created_at" bson:"created_at"`
 	LastLogin     time.Time `json:"last_login" bson:"last_login"`
+	MergedInto    string    `json:"merged_into,omitempty" bson:"merged_into,omitempty"` // on a retired guest, the user it was merged into
 }
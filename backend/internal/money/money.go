@@ -0,0 +1,196 @@
+// Package money stores amounts of currency as integer minor units so that
+// sums and discounts are exact.
+//
+// Rounding rule: whenever a value has to be rounded to a whole minor unit
+// (parsing a decimal, taking a percentage) it is rounded half away from zero,
+// so 0.005 becomes 0.01 and -0.005 becomes -0.01.
+package money
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"sort"
+	"strconv"
+)
+
+// Scale is the number of minor units in one unit of currency.
+const Scale = 100
+
+// Money is an amount in minor units (1/100 of a baht). It is stored in Mongo
+// as an int64 and sent as JSON as a decimal number of major units, e.g. 89.99.
+//
+// Percentages such as Campaign.DiscountValue use the same type, so 12.5% is
+// held as 12.50.
+type Money int64
+
+// FromMinor returns the amount of v minor units.
+func FromMinor(v int64) Money {
+	return Money(v)
+}
+
+// FromMajor returns the amount of v whole units of currency.
+func FromMajor(v int64) Money {
+	return Money(v * Scale)
+}
+
+// FromFloat converts a float of major units using its shortest decimal
+// representation, so 89.995 rounds to 90.00 rather than 89.99.
+func FromFloat(f float64) Money {
+	m, _ := Parse(strconv.FormatFloat(f, 'f', -1, 64))
+	return m
+}
+
+// Parse reads a decimal string of major units such as "12", "89.99" or
+// "1e2", rounding to a whole minor unit.
+func Parse(s string) (Money, error) {
+	r, ok := new(big.Rat).SetString(s)
+	if !ok {
+		return 0, fmt.Errorf("money: invalid amount %q", s)
+	}
+	r.Mul(r, big.NewRat(Scale, 1))
+	return Money(roundRat(r)), nil
+}
+
+// Minor returns the amount in minor units.
+func (m Money) Minor() int64 {
+	return int64(m)
+}
+
+// Float64 returns the amount in major units. Use it for display only.
+func (m Money) Float64() float64 {
+	return float64(m) / Scale
+}
+
+// String formats the amount in major units with two decimals.
+func (m Money) String() string {
+	sign := ""
+	v := int64(m)
+	if v < 0 {
+		sign = "-"
+		v = -v
+	}
+	return fmt.Sprintf("%s%d.%02d", sign, v/Scale, v%Scale)
+}
+
+// Mul returns the amount multiplied by n.
+func (m Money) Mul(n int64) Money {
+	return m * Money(n)
+}
+
+// Percent returns p percent of the amount, where p uses the two-decimal
+// precision of Money (12.50 means 12.5%).
+func (m Money) Percent(p Money) Money {
+	r := new(big.Rat).SetFrac(
+		new(big.Int).Mul(big.NewInt(int64(m)), big.NewInt(int64(p))),
+		big.NewInt(100*Scale),
+	)
+	return Money(roundRat(r))
+}
+
+// IncludedTax returns the part of a tax-inclusive amount that a tax of rate
+// percent accounts for, i.e. amount*rate/(100+rate).
+func (m Money) IncludedTax(rate Money) Money {
+	r := new(big.Rat).SetFrac(
+		new(big.Int).Mul(big.NewInt(int64(m)), big.NewInt(int64(rate))),
+		big.NewInt(100*Scale+int64(rate)),
+	)
+	return Money(roundRat(r))
+}
+
+// Allocate splits the amount between weights in proportion to each weight.
+// The shares always add up to the amount: leftover minor units go to the
+// largest remainders, earlier weights first on ties. Weights must not be
+// negative; if they are all zero the shares are split evenly instead.
+func (m Money) Allocate(weights []Money) []Money {
+	shares := make([]Money, len(weights))
+	if len(weights) == 0 {
+		return shares
+	}
+
+	var total int64
+	for _, w := range weights {
+		total += int64(w)
+	}
+	if total == 0 {
+		weights = make([]Money, len(weights))
+		for i := range weights {
+			weights[i] = 1
+		}
+		total = int64(len(weights))
+	}
+
+	type remainder struct {
+		index int
+		value *big.Int
+	}
+	remainders := make([]remainder, len(weights))
+	amount := big.NewInt(int64(m))
+	divisor := big.NewInt(total)
+	allocated := Money(0)
+	for i, w := range weights {
+		q, r := new(big.Int).QuoRem(new(big.Int).Mul(amount, big.NewInt(int64(w))), divisor, new(big.Int))
+		shares[i] = Money(q.Int64())
+		allocated += shares[i]
+		remainders[i] = remainder{index: i, value: r.Abs(r)}
+	}
+
+	sort.SliceStable(remainders, func(i, j int) bool {
+		return remainders[i].value.Cmp(remainders[j].value) > 0
+	})
+	step := Money(1)
+	if m < 0 {
+		step = -1
+	}
+	for i := 0; allocated != m; i++ {
+		shares[remainders[i%len(remainders)].index] += step
+		allocated += step
+	}
+	return shares
+}
+
+// Min returns the smaller of a and b.
+func Min(a, b Money) Money {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// MarshalJSON writes the amount as a number of major units.
+func (m Money) MarshalJSON() ([]byte, error) {
+	return []byte(m.String()), nil
+}
+
+// UnmarshalJSON accepts a number or a numeric string of major units.
+func (m *Money) UnmarshalJSON(data []byte) error {
+	if bytes.Equal(data, []byte("null")) {
+		return nil
+	}
+	s := string(data)
+	if len(data) > 0 && data[0] == '"' {
+		if err := json.Unmarshal(data, &s); err != nil {
+			return err
+		}
+	}
+	v, err := Parse(s)
+	if err != nil {
+		return err
+	}
+	*m = v
+	return nil
+}
+
+// roundRat rounds r to an integer, half away from zero.
+func roundRat(r *big.Rat) int64 {
+	num := new(big.Int).Abs(r.Num())
+	q, rem := new(big.Int).QuoRem(num, r.Denom(), new(big.Int))
+	if rem.Mul(rem, big.NewInt(2)).Cmp(r.Denom()) >= 0 {
+		q.Add(q, big.NewInt(1))
+	}
+	if r.Sign() < 0 {
+		q.Neg(q)
+	}
+	return q.Int64()
+}
@@ -0,0 +1,203 @@
+package money
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    Money
+		wantErr bool
+	}{
+		{in: "12", want: 1200},
+		{in: "89.99", want: 8999},
+		{in: "1e2", want: 10000},
+		{in: "0.5", want: 50},
+		{in: "1.004", want: 100},
+		{in: "1.005", want: 101},
+		{in: "0.005", want: 1},
+		{in: "-12.50", want: -1250},
+		{in: "-0.005", want: -1},
+		{in: "-1.004", want: -100},
+		{in: "", wantErr: true},
+		{in: "abc", wantErr: true},
+		{in: "1,50", wantErr: true},
+		{in: "12 baht", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := Parse(tt.in)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Parse(%q) err = %v, want error %v", tt.in, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("Parse(%q) = %d, want %d", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFromFloat(t *testing.T) {
+	tests := []struct {
+		in   float64
+		want Money
+	}{
+		{in: 0, want: 0},
+		{in: 89.99, want: 8999},
+		{in: 89.995, want: 9000},
+		{in: 0.005, want: 1},
+		{in: -0.005, want: -1},
+		{in: 0.004, want: 0},
+		{in: 0.1 + 0.2, want: 30},
+		{in: 1e6, want: 100000000},
+	}
+	for _, tt := range tests {
+		if got := FromFloat(tt.in); got != tt.want {
+			t.Errorf("FromFloat(%v) = %d, want %d", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestPercent(t *testing.T) {
+	tests := []struct {
+		amount, percent, want Money
+	}{
+		{amount: FromMajor(1000), percent: FromMajor(10), want: FromMajor(100)},
+		{amount: FromMajor(1000), percent: 1250, want: FromMajor(125)},
+		{amount: 8999, percent: FromMajor(7), want: 630},
+		{amount: 5, percent: FromMajor(50), want: 3},
+		{amount: -5, percent: FromMajor(50), want: -3},
+		{amount: FromMajor(80), percent: 0, want: 0},
+		{amount: FromMajor(80), percent: FromMajor(100), want: FromMajor(80)},
+	}
+	for _, tt := range tests {
+		if got := tt.amount.Percent(tt.percent); got != tt.want {
+			t.Errorf("%s.Percent(%s) = %s, want %s", tt.amount, tt.percent, got, tt.want)
+		}
+	}
+}
+
+func TestIncludedTax(t *testing.T) {
+	tests := []struct {
+		amount, rate, want Money
+	}{
+		{amount: FromMajor(107), rate: FromMajor(7), want: FromMajor(7)},
+		{amount: FromMajor(100), rate: FromMajor(7), want: 654},
+		{amount: FromMajor(10), rate: 1250, want: 111},
+		{amount: FromMajor(100), rate: 0, want: 0},
+		{amount: 0, rate: FromMajor(7), want: 0},
+		{amount: -FromMajor(107), rate: FromMajor(7), want: -FromMajor(7)},
+	}
+	for _, tt := range tests {
+		if got := tt.amount.IncludedTax(tt.rate); got != tt.want {
+			t.Errorf("%s.IncludedTax(%s) = %s, want %s", tt.amount, tt.rate, got, tt.want)
+		}
+	}
+}
+
+func TestAllocate(t *testing.T) {
+	tests := []struct {
+		name    string
+		amount  Money
+		weights []Money
+		want    []Money
+	}{
+		{name: "no weights", amount: FromMajor(10), weights: nil, want: []Money{}},
+		{name: "even", amount: FromMajor(90), weights: []Money{1, 1, 1}, want: []Money{3000, 3000, 3000}},
+		{name: "leftover to earlier on ties", amount: FromMajor(100), weights: []Money{1, 1, 1}, want: []Money{3334, 3333, 3333}},
+		{name: "leftover to largest remainder", amount: 100, weights: []Money{100, 200, 400}, want: []Money{14, 29, 57}},
+		{name: "proportional", amount: FromMajor(100), weights: []Money{FromMajor(600), FromMajor(400)}, want: []Money{FromMajor(60), FromMajor(40)}},
+		{name: "zero weight gets nothing", amount: 100, weights: []Money{0, 200, 100}, want: []Money{0, 67, 33}},
+		{name: "all zero weights split evenly", amount: 1, weights: []Money{0, 0}, want: []Money{1, 0}},
+		{name: "negative amount", amount: -100, weights: []Money{1, 1, 1}, want: []Money{-34, -33, -33}},
+		{name: "zero amount", amount: 0, weights: []Money{3, 5}, want: []Money{0, 0}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.amount.Allocate(tt.weights)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Allocate = %v, want %v", got, tt.want)
+			}
+			var sum Money
+			for _, share := range got {
+				sum += share
+			}
+			if len(got) > 0 && sum != tt.amount {
+				t.Errorf("shares add up to %d, want %d", sum, tt.amount)
+			}
+		})
+	}
+}
+
+func TestJSON(t *testing.T) {
+	marshal := []struct {
+		in   Money
+		want string
+	}{
+		{in: 8999, want: "89.99"},
+		{in: FromMajor(12), want: "12.00"},
+		{in: 5, want: "0.05"},
+		{in: -5, want: "-0.05"},
+		{in: -1250, want: "-12.50"},
+	}
+	for _, tt := range marshal {
+		got, err := json.Marshal(tt.in)
+		if err != nil || string(got) != tt.want {
+			t.Errorf("Marshal(%d) = %s, %v, want %s", tt.in, got, err, tt.want)
+		}
+	}
+
+	unmarshal := []struct {
+		in      string
+		want    Money
+		wantErr bool
+	}{
+		{in: `89.99`, want: 8999},
+		{in: `"12.5"`, want: 1250},
+		{in: `1e2`, want: 10000},
+		{in: `0.005`, want: 1},
+		{in: `-3`, want: -300},
+		{in: `"abc"`, wantErr: true},
+		{in: `true`, wantErr: true},
+	}
+	for _, tt := range unmarshal {
+		var got Money
+		err := json.Unmarshal([]byte(tt.in), &got)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("Unmarshal(%s) = %d, %v, want %d (error %v)", tt.in, got, err, tt.want, tt.wantErr)
+		}
+	}
+
+	t.Run("null leaves the value", func(t *testing.T) {
+		got := Money(42)
+		if err := json.Unmarshal([]byte("null"), &got); err != nil || got != 42 {
+			t.Errorf("Unmarshal(null) = %d, %v, want 42", got, err)
+		}
+	})
+
+	t.Run("round trip", func(t *testing.T) {
+		type line struct {
+			Price Money  `json:"price"`
+			Tax   *Money `json:"tax,omitempty"`
+		}
+		tax := Money(-1)
+		in := line{Price: 8999, Tax: &tax}
+		data, err := json.Marshal(in)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != `{"price":89.99,"tax":-0.01}` {
+			t.Errorf("Marshal = %s", data)
+		}
+		var out line
+		if err := json.Unmarshal(data, &out); err != nil {
+			t.Fatal(err)
+		}
+		if out.Price != in.Price || out.Tax == nil || *out.Tax != tax {
+			t.Errorf("round trip = %+v, want %+v", out, in)
+		}
+	})
+}
@@ -0,0 +1,321 @@
+package payment
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/faiisu/ecom-backend/internal/money"
+	"github.com/google/uuid"
+)
+
+// Outcome is how the fake provider answers a call.
+type Outcome string
+
+const (
+	Succeed Outcome = "succeed"
+	Decline Outcome = "decline"
+	// Timeout returns ErrTimeout after the call has taken effect, the way a
+	// lost response from a real gateway would.
+	Timeout Outcome = "timeout"
+	// Async answers StatusPending and succeeds later, reported through the
+	// webhook.
+	Async Outcome = "pending"
+)
+
+// Operations the fake provider can be scripted for.
+const (
+	OpAuthorize = "authorize"
+	OpCapture   = "capture"
+	OpVoid      = "void"
+	OpRefund    = "refund"
+)
+
+// Fake is an in-process provider for local work and tests. Every call
+// succeeds unless an outcome was set with SetDefault or queued with Script.
+// Async calls settle after SettleDelay and are posted, signed with Secret, to
+// WebhookURL; with no WebhookURL they wait for Settle.
+type Fake struct {
+	Secret      []byte
+	WebhookURL  string
+	SettleDelay time.Duration
+
+	mu       sync.Mutex
+	defaults map[string]Outcome
+	script   map[string][]Outcome
+	payments map[string]*fakePayment
+	client   *http.Client
+}
+
+type fakePayment struct {
+	orderID    string
+	status     string
+	authorized money.Money
+	captured   money.Money
+	refunded   money.Money
+	settle     string      // status a pending call settles to
+	amount     money.Money // amount of the pending call
+}
+
+func NewFake(secret string) *Fake {
+	return &Fake{
+		Secret:      []byte(secret),
+		SettleDelay: 2 * time.Second,
+		defaults:    map[string]Outcome{},
+		script:      map[string][]Outcome{},
+		payments:    map[string]*fakePayment{},
+		client:      &http.Client{Timeout: 5 * time.Second},
+	}
+}
+
+func (f *Fake) Name() string { return "fake" }
+
+// SetDefault makes op answer outcome whenever nothing is queued for it.
+func (f *Fake) SetDefault(op string, outcome Outcome) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.defaults[op] = outcome
+}
+
+// Script queues outcomes for the next calls of op, ahead of the default.
+func (f *Fake) Script(op string, outcomes ...Outcome) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.script[op] = append(f.script[op], outcomes...)
+}
+
+// Configure reads defaults written as "authorize=decline,capture=pending".
+func (f *Fake) Configure(spec string) error {
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		op, outcome, ok := strings.Cut(part, "=")
+		if !ok {
+			return fmt.Errorf("fake payment outcome %q is not op=outcome", part)
+		}
+		switch op {
+		case OpAuthorize, OpCapture, OpVoid, OpRefund:
+		default:
+			return fmt.Errorf("unknown payment operation %q", op)
+		}
+		switch Outcome(outcome) {
+		case Succeed, Decline, Timeout, Async:
+		default:
+			return fmt.Errorf("unknown payment outcome %q", outcome)
+		}
+		f.SetDefault(op, Outcome(outcome))
+	}
+	return nil
+}
+
+// next pops the outcome for op. The caller holds f.mu.
+func (f *Fake) next(op string) Outcome {
+	if queued := f.script[op]; len(queued) > 0 {
+		f.script[op] = queued[1:]
+		return queued[0]
+	}
+	if outcome, ok := f.defaults[op]; ok {
+		return outcome
+	}
+	return Succeed
+}
+
+func (f *Fake) Authorize(ctx context.Context, req AuthorizeRequest) (Result, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	outcome := f.next(OpAuthorize)
+	if outcome == Decline {
+		return Result{Status: StatusDeclined, Message: "card declined"}, ErrDeclined
+	}
+
+	id := "fake_" + uuid.New().String()
+	p := &fakePayment{orderID: req.OrderID, status: StatusAuthorized, authorized: req.Amount}
+	f.payments[id] = p
+	return f.answer(id, p, outcome, StatusAuthorized, req.Amount)
+}
+
+func (f *Fake) Capture(ctx context.Context, paymentID string, amount money.Money) (Result, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	p, ok := f.payments[paymentID]
+	if !ok {
+		return Result{}, ErrUnknownPayment
+	}
+	if p.status != StatusAuthorized {
+		return Result{}, fmt.Errorf("cannot capture a %s payment", p.status)
+	}
+	if amount > p.authorized {
+		return Result{}, fmt.Errorf("capture of %s is more than the %s authorized", amount, p.authorized)
+	}
+
+	outcome := f.next(OpCapture)
+	if outcome == Decline {
+		p.status = StatusDeclined
+		return Result{PaymentID: paymentID, Status: StatusDeclined, Message: "capture declined"}, ErrDeclined
+	}
+	p.captured = amount
+	return f.answer(paymentID, p, outcome, StatusCaptured, amount)
+}
+
+func (f *Fake) Void(ctx context.Context, paymentID string) (Result, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	p, ok := f.payments[paymentID]
+	if !ok {
+		return Result{}, ErrUnknownPayment
+	}
+	if p.status != StatusAuthorized && p.status != StatusPending {
+		return Result{}, fmt.Errorf("cannot void a %s payment", p.status)
+	}
+
+	outcome := f.next(OpVoid)
+	if outcome == Decline {
+		return Result{PaymentID: paymentID, Status: p.status, Message: "void declined"}, ErrDeclined
+	}
+	return f.answer(paymentID, p, outcome, StatusVoided, p.authorized)
+}
+
+func (f *Fake) Refund(ctx context.Context, paymentID string, amount money.Money) (Result, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	p, ok := f.payments[paymentID]
+	if !ok {
+		return Result{}, ErrUnknownPayment
+	}
+	if p.status != StatusCaptured && p.status != StatusRefunded {
+		return Result{}, fmt.Errorf("cannot refund a %s payment", p.status)
+	}
+	if amount > p.captured-p.refunded {
+		return Result{}, fmt.Errorf("refund of %s is more than the %s left", amount, p.captured-p.refunded)
+	}
+
+	outcome := f.next(OpRefund)
+	if outcome == Decline {
+		return Result{PaymentID: paymentID, Status: p.status, Message: "refund declined"}, ErrDeclined
+	}
+	p.refunded += amount
+	return f.answer(paymentID, p, outcome, StatusRefunded, amount)
+}
+
+// answer moves p to status, right away or once settled for an Async
+// outcome. The caller holds f.mu.
+func (f *Fake) answer(id string, p *fakePayment, outcome Outcome, status string, amount money.Money) (Result, error) {
+	switch outcome {
+	case Async:
+		p.status = StatusPending
+		p.settle = status
+		p.amount = amount
+		if f.WebhookURL != "" {
+			go func() {
+				time.Sleep(f.SettleDelay)
+				if _, err := f.Settle(context.Background(), id); err != nil {
+					log.Printf("fake payment %s: %v", id, err)
+				}
+			}()
+		}
+		return Result{PaymentID: id, Status: StatusPending}, nil
+	case Timeout:
+		p.status = status
+		return Result{PaymentID: id}, ErrTimeout
+	}
+	p.status = status
+	return Result{PaymentID: id, Status: status}, nil
+}
+
+// Settle completes a pending call on paymentID and posts the event to
+// WebhookURL, if set. It returns the event either way.
+func (f *Fake) Settle(ctx context.Context, paymentID string) (Event, error) {
+	f.mu.Lock()
+	p, ok := f.payments[paymentID]
+	if !ok {
+		f.mu.Unlock()
+		return Event{}, ErrUnknownPayment
+	}
+	if p.status != StatusPending {
+		f.mu.Unlock()
+		return Event{}, fmt.Errorf("payment is %s, nothing to settle", p.status)
+	}
+	p.status = p.settle
+	event := Event{
+		ID:        uuid.New().String(),
+		PaymentID: paymentID,
+		OrderID:   p.orderID,
+		Status:    p.status,
+		Amount:    p.amount,
+		At:        time.Now(),
+	}
+	f.mu.Unlock()
+
+	if f.WebhookURL == "" {
+		return event, nil
+	}
+	return event, f.post(ctx, event)
+}
+
+func (f *Fake) post(ctx context.Context, event Event) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, f.WebhookURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(SignatureHeader, Sign(f.Secret, body))
+
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= http.StatusBadRequest {
+		return fmt.Errorf("webhook answered %s", resp.Status)
+	}
+	return nil
+}
+
+func (f *Fake) Lookup(ctx context.Context, paymentID string) (Event, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	p, ok := f.payments[paymentID]
+	if !ok {
+		return Event{}, ErrUnknownPayment
+	}
+	event := Event{ID: uuid.New().String(), PaymentID: paymentID, OrderID: p.orderID, Status: p.status, At: time.Now()}
+	switch p.status {
+	case StatusAuthorized, StatusVoided:
+		event.Amount = p.authorized
+	case StatusCaptured:
+		event.Amount = p.captured
+	case StatusRefunded:
+		event.Amount = p.refunded
+	case StatusPending:
+		event.Amount = p.amount
+	}
+	return event, nil
+}
+
+func (f *Fake) ParseWebhook(body []byte, signature string) (Event, error) {
+	if !VerifySignature(f.Secret, body, signature) {
+		return Event{}, ErrInvalidSignature
+	}
+	var event Event
+	if err := json.Unmarshal(body, &event); err != nil {
+		return Event{}, err
+	}
+	return event, nil
+}
@@ -0,0 +1,61 @@
+package payment
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/faiisu/ecom-backend/internal/money"
+)
+
+func TestFakeLookupAfterTimeout(t *testing.T) {
+	ctx := context.Background()
+	amount := money.FromMajor(250)
+
+	tests := []struct {
+		name       string
+		op         string
+		outcome    Outcome
+		wantErr    error
+		wantStatus string
+	}{
+		{name: "capture timed out after taking effect", op: OpCapture, outcome: Timeout, wantErr: ErrTimeout, wantStatus: StatusCaptured},
+		{name: "capture settles later", op: OpCapture, outcome: Async, wantStatus: StatusPending},
+		{name: "capture declined", op: OpCapture, outcome: Decline, wantErr: ErrDeclined, wantStatus: StatusDeclined},
+		{name: "void timed out after taking effect", op: OpVoid, outcome: Timeout, wantErr: ErrTimeout, wantStatus: StatusVoided},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := NewFake("secret")
+			auth, err := fake.Authorize(ctx, AuthorizeRequest{OrderID: "o1", Amount: amount})
+			if err != nil {
+				t.Fatalf("Authorize: %v", err)
+			}
+
+			fake.Script(tt.op, tt.outcome)
+			if tt.op == OpCapture {
+				_, err = fake.Capture(ctx, auth.PaymentID, amount)
+			} else {
+				_, err = fake.Void(ctx, auth.PaymentID)
+			}
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("%s: err = %v, want %v", tt.op, err, tt.wantErr)
+			}
+
+			event, err := fake.Lookup(ctx, auth.PaymentID)
+			if err != nil {
+				t.Fatalf("Lookup: %v", err)
+			}
+			if event.Status != tt.wantStatus || event.OrderID != "o1" {
+				t.Errorf("Lookup = %s for order %s, want %s for o1", event.Status, event.OrderID, tt.wantStatus)
+			}
+			if event.Status == StatusCaptured && event.Amount != amount {
+				t.Errorf("captured %s, want %s", event.Amount, amount)
+			}
+		})
+	}
+
+	if _, err := NewFake("secret").Lookup(ctx, "missing"); !errors.Is(err, ErrUnknownPayment) {
+		t.Errorf("Lookup of an unknown payment: err = %v, want ErrUnknownPayment", err)
+	}
+}
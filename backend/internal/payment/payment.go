@@ -0,0 +1,106 @@
+// Package payment is the boundary between checkout and a payment gateway.
+// Handlers only talk to a Provider; the gateway in use is picked from config
+// at startup. A payment is authorized before the order is written, captured
+// once it is, and voided or refunded when the order is cancelled or refunded.
+//
+// A gateway may answer any step with StatusPending and report the outcome
+// later through a signed webhook, which ParseWebhook turns into an Event.
+// When neither answer arrives, Lookup asks where the payment stands.
+package payment
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"time"
+
+	"github.com/faiisu/ecom-backend/internal/money"
+)
+
+// Payment statuses reported by providers.
+const (
+	StatusAuthorized = "authorized"
+	StatusCaptured   = "captured"
+	StatusVoided     = "voided"
+	StatusRefunded   = "refunded"
+	StatusDeclined   = "declined"
+	StatusPending    = "pending" // the outcome arrives later through the webhook
+)
+
+// SignatureHeader carries the webhook signature.
+const SignatureHeader = "X-Payment-Signature"
+
+var (
+	ErrDeclined         = errors.New("payment declined")
+	ErrTimeout          = errors.New("payment provider timed out")
+	ErrUnknownPayment   = errors.New("unknown payment")
+	ErrInvalidSignature = errors.New("invalid webhook signature")
+)
+
+// Provider is a payment gateway. Declines are reported as ErrDeclined and
+// calls that got no answer in time as ErrTimeout; in both cases nothing
+// should be assumed about the money.
+type Provider interface {
+	// Name identifies the provider on stored orders.
+	Name() string
+	// Authorize holds amount on the customer's payment method.
+	Authorize(ctx context.Context, req AuthorizeRequest) (Result, error)
+	// Capture collects amount of an authorized payment.
+	Capture(ctx context.Context, paymentID string, amount money.Money) (Result, error)
+	// Void releases an authorization that was not captured.
+	Void(ctx context.Context, paymentID string) (Result, error)
+	// Refund gives back amount of a captured payment.
+	Refund(ctx context.Context, paymentID string, amount money.Money) (Result, error)
+	// Lookup reports where a payment stands now, as the event a webhook
+	// would carry, for calls whose answer never arrived.
+	Lookup(ctx context.Context, paymentID string) (Event, error)
+	// ParseWebhook checks signature and decodes a webhook body.
+	ParseWebhook(body []byte, signature string) (Event, error)
+}
+
+type AuthorizeRequest struct {
+	OrderID string
+	UserID  string
+	Amount  money.Money
+}
+
+// Result is a provider's answer to a single call.
+type Result struct {
+	PaymentID string
+	Status    string
+	Message   string
+}
+
+// Event is an outcome a provider reports after the call that started it.
+type Event struct {
+	ID        string      `json:"id"`
+	PaymentID string      `json:"payment_id"`
+	OrderID   string      `json:"order_id"`
+	Status    string      `json:"status"`
+	Amount    money.Money `json:"amount"`
+	At        time.Time   `json:"at"`
+}
+
+// Sign returns the hex HMAC-SHA256 of body under secret.
+func Sign(secret, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// VerifySignature reports whether signature is Sign(secret, body). With an
+// empty secret anyone could sign, so nothing verifies.
+func VerifySignature(secret, body []byte, signature string) bool {
+	if len(secret) == 0 {
+		return false
+	}
+	expected, err := hex.DecodeString(signature)
+	if err != nil {
+		return false
+	}
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(body)
+	return hmac.Equal(mac.Sum(nil), expected)
+}
@@ -0,0 +1,455 @@
+// Package pricing turns cart lines, a user and the selected campaigns into an
+// itemized quote. It has no knowledge of HTTP or storage so checkout, previews
+// and reports all share the same discount math.
+//
+// Discounts are applied in a fixed order:
+//  1. Campaigns, sorted by their campaign category rank (lowest first). Ties
+//     are broken by campaign category ID and then campaign ID. A campaign
+//     whose category is unknown is treated as rank 0.
+//  2. Each campaign is computed against the running total left by the
+//     campaigns before it, and never takes off more than that total. Only
+//     lines in the campaign's target product categories count towards that
+//     total; campaigns without targets cover the whole cart.
+//  3. Points are only redeemed through point campaigns, at the campaign's
+//     place in that order. One point is worth one unit of currency.
+//  4. The shipping fee is a line of its own. Campaigns leave it alone unless
+//     their ShippingScope includes it; "only" campaigns discount nothing else.
+//  5. Tax comes last, on what is left of each line and of the shipping fee
+//     after every discount and point. Each line uses the rate for its product
+//     category and the shipping region; shipping uses the region's rate.
+//     Inclusive tax is the part of the total it accounts for, exclusive tax
+//     is added to the total. The quote's tax is the sum of the lines' taxes.
+//
+// All amounts are money.Money, so results are exact; percentages round half
+// away from zero and each discount is spread over its lines to the minor unit.
+package pricing
+
+import (
+	"errors"
+	"sort"
+
+	"github.com/faiisu/ecom-backend/internal/models"
+	"github.com/faiisu/ecom-backend/internal/money"
+	"github.com/faiisu/ecom-backend/internal/tax"
+)
+
+// Discount types understood by the engine.
+const (
+	DiscountPercent      = "percent"
+	DiscountFixed        = "fixed"
+	DiscountPoint        = "point"
+	DiscountSpendAndSave = "spendAndSave"
+
+	// discountPointAlias is the spelling stored by the campaign form.
+	discountPointAlias = "points"
+)
+
+// Campaign shipping scopes. The empty scope leaves shipping alone.
+const (
+	ShippingInclude = "include" // shipping counts as one more eligible line
+	ShippingOnly    = "only"    // only the shipping fee is discounted
+)
+
+// PointValue is what a single redeemed point takes off the total.
+const PointValue = money.Money(money.Scale)
+
+var (
+	ErrEmptyCart          = errors.New("cart is empty")
+	ErrInsufficientPoints = errors.New("insufficient points")
+	ErrNegativePoints     = errors.New("points to redeem cannot be negative")
+)
+
+// Reasons reported for campaigns that were selected but not applied.
+const (
+	ReasonNotFound        = "campaign not found"
+	ReasonInactive        = "campaign is not active"
+	ReasonNoEligibleItems = "no cart items in the campaign's product categories"
+	ReasonNotQualified    = "cart does not qualify for this campaign"
+	ReasonNoShipping      = "there is no shipping fee to discount"
+)
+
+// CampaignConflict lists campaigns picked together from a campaign category
+// that only allows one of them.
+type CampaignConflict struct {
+	CampaignCategoryID   string   `json:"campaign_category_id"`
+	CampaignCategoryName string   `json:"campaign_category_name"`
+	CampaignIDs          []string `json:"campaign_ids"`
+	CampaignNames        []string `json:"campaign_names"`
+}
+
+// ConflictError is returned by Calculate when the selected campaigns break
+// the exclusivity of one or more campaign categories.
+type ConflictError struct {
+	Conflicts []CampaignConflict
+}
+
+func (e *ConflictError) Error() string {
+	return "more than one campaign selected from an exclusive campaign category"
+}
+
+// Line is a single cart entry together with the product it refers to.
+// TaxRate, when set, is used instead of the rate from the tax table, e.g.
+// the rate an order item was charged.
+type Line struct {
+	Product  models.Product
+	Quantity int
+	TaxRate  *money.Money
+}
+
+// Input is everything the engine needs to price a cart. Campaigns must carry
+// their target ProductCategories, and Categories only needs to hold the
+// campaign categories referenced by Campaigns. PointUsed is the most points
+// the user is willing to redeem; zero means no limit beyond the balance and
+// a negative number is an error.
+// Shipping is the delivery fee, zero when nothing is shipped. Regions are
+// the names the shipping address goes by (province, country) for tax rules.
+type Input struct {
+	Lines      []Line
+	User       models.User
+	Campaigns  []models.Campaign
+	Categories []models.CampaignsCategories
+	PointUsed  int
+	Shipping   money.Money
+	Tax        tax.Table
+	Regions    []string
+}
+
+// QuoteLine is a priced cart line. Discount is the share of all campaign and
+// point discounts allocated to the line, and Total is what is left to pay.
+type QuoteLine struct {
+	ProductID           string      `json:"product_id"`
+	ProductName         string      `json:"product_name"`
+	ProductCategoryID   string      `json:"product_category_id"`
+	ProductCategoryName string      `json:"product_category_name"`
+	UnitPrice           money.Money `json:"unit_price"`
+	Quantity            int         `json:"quantity"`
+	LineTotal           money.Money `json:"line_total"`
+	Discount            money.Money `json:"discount"`
+	Total               money.Money `json:"total"`
+	TaxRate             money.Money `json:"tax_rate"`
+	Tax                 money.Money `json:"tax"` // included in Total, or added to the quote's total when exclusive
+}
+
+// ShippingLine is the delivery fee with the campaign discounts it received.
+type ShippingLine struct {
+	Fee      money.Money `json:"fee"`
+	Discount money.Money `json:"discount"`
+	Total    money.Money `json:"total"`
+	TaxRate  money.Money `json:"tax_rate"`
+	Tax      money.Money `json:"tax"`
+}
+
+// CampaignDiscount is a campaign that was applied and the amount it saved.
+// Campaign keeps the full terms it was applied with.
+type CampaignDiscount struct {
+	CampaignID    string          `json:"campaign_id"`
+	Name          string          `json:"name"`
+	DiscountType  string          `json:"discount_type"`
+	DiscountValue money.Money     `json:"discount_value"`
+	Amount        money.Money     `json:"amount"`
+	Campaign      models.Campaign `json:"-"`
+}
+
+// RejectedCampaign is a selected campaign that did not apply, with the reason.
+type RejectedCampaign struct {
+	CampaignID string `json:"campaign_id"`
+	Name       string `json:"name,omitempty"`
+	Reason     string `json:"reason"`
+}
+
+// Quote is the fully itemized result of pricing a cart. Subtotal covers the
+// items only; Total includes what is left of the shipping fee, and the tax
+// when TaxMode is exclusive.
+type Quote struct {
+	Lines             []QuoteLine        `json:"lines"`
+	Subtotal          money.Money        `json:"subtotal"`
+	Shipping          ShippingLine       `json:"shipping"`
+	Campaigns         []CampaignDiscount `json:"campaigns"`
+	RejectedCampaigns []RejectedCampaign `json:"rejected_campaigns"`
+	PointUsed         int                `json:"point_used"`
+	PointDiscount     money.Money        `json:"point_discount"`
+	TaxMode           string             `json:"tax_mode"`
+	Tax               money.Money        `json:"tax"`
+	Total             money.Money        `json:"total"`
+}
+
+// Calculate prices the input following the order described in the package
+// documentation. The total never goes below zero.
+func Calculate(in Input) (Quote, error) {
+	if len(in.Lines) == 0 {
+		return Quote{}, ErrEmptyCart
+	}
+	if in.PointUsed < 0 {
+		return Quote{}, ErrNegativePoints
+	}
+	if in.PointUsed > in.User.Point {
+		return Quote{}, ErrInsufficientPoints
+	}
+
+	quote := Quote{
+		Lines:             make([]QuoteLine, 0, len(in.Lines)),
+		Campaigns:         []CampaignDiscount{},
+		RejectedCampaigns: []RejectedCampaign{},
+	}
+
+	active := make([]models.Campaign, 0, len(in.Campaigns))
+	for _, campaign := range in.Campaigns {
+		if !campaign.IsActive {
+			quote.Reject(campaign.ID, campaign.Name, ReasonInactive)
+			continue
+		}
+		active = append(active, campaign)
+	}
+	if conflicts := FindConflicts(active, in.Categories); len(conflicts) > 0 {
+		return Quote{}, &ConflictError{Conflicts: conflicts}
+	}
+
+	for _, line := range in.Lines {
+		lineTotal := line.Product.Price.Mul(int64(line.Quantity))
+		quote.Lines = append(quote.Lines, QuoteLine{
+			ProductID:           line.Product.ID,
+			ProductName:         line.Product.Name,
+			ProductCategoryID:   line.Product.ProductCategoryID,
+			ProductCategoryName: line.Product.ProductCategoryName,
+			UnitPrice:           line.Product.Price,
+			Quantity:            line.Quantity,
+			LineTotal:           lineTotal,
+		})
+		quote.Subtotal += lineTotal
+	}
+
+	// remaining holds each line's total after the campaigns applied so far,
+	// with the shipping fee in the last slot
+	shipping := len(quote.Lines)
+	remaining := make([]money.Money, len(quote.Lines)+1)
+	for i, line := range quote.Lines {
+		remaining[i] = line.LineTotal
+	}
+	remaining[shipping] = in.Shipping
+
+	points := in.User.Point
+	if in.PointUsed > 0 {
+		points = in.PointUsed
+	}
+
+	for _, campaign := range SortCampaigns(active, in.Categories) {
+		var eligible []int
+		if campaign.ShippingScope != ShippingOnly {
+			eligible = eligibleLines(campaign, in.Lines)
+		}
+		if campaign.ShippingScope != "" && in.Shipping > 0 {
+			eligible = append(eligible, shipping)
+		}
+		if len(eligible) == 0 {
+			reason := ReasonNoEligibleItems
+			if campaign.ShippingScope == ShippingOnly {
+				reason = ReasonNoShipping
+			}
+			quote.Reject(campaign.ID, campaign.Name, reason)
+			continue
+		}
+		weights := make([]money.Money, len(eligible))
+		var base money.Money
+		for k, i := range eligible {
+			weights[k] = remaining[i]
+			base += remaining[i]
+		}
+
+		var discount money.Money
+		if IsPointCampaign(campaign) {
+			redeemed := pointRedemption(campaign, base, points)
+			points -= redeemed
+			quote.PointUsed += redeemed
+			discount = PointValue.Mul(int64(redeemed))
+			quote.PointDiscount += discount
+		} else {
+			discount = money.Min(campaignDiscount(campaign, base), base)
+		}
+		if discount <= 0 {
+			quote.Reject(campaign.ID, campaign.Name, ReasonNotQualified)
+			continue
+		}
+		quote.Campaigns = append(quote.Campaigns, CampaignDiscount{
+			CampaignID:    campaign.ID,
+			Name:          campaign.Name,
+			DiscountType:  campaign.DiscountType,
+			DiscountValue: campaign.DiscountValue,
+			Amount:        discount,
+			Campaign:      campaign,
+		})
+
+		// Spread the discount over the eligible lines in proportion to what is left on them
+		for k, share := range discount.Allocate(weights) {
+			remaining[eligible[k]] -= share
+		}
+	}
+
+	var total money.Money
+	for i, amount := range remaining[:shipping] {
+		line := &quote.Lines[i]
+		line.Discount = line.LineTotal - amount
+		line.Total = amount
+		line.TaxRate = in.Tax.Rate(line.ProductCategoryID, in.Regions...)
+		if rate := in.Lines[i].TaxRate; rate != nil {
+			line.TaxRate = *rate
+		}
+		line.Tax = in.Tax.Amount(amount, line.TaxRate)
+		quote.Tax += line.Tax
+		total += amount
+	}
+	quote.Shipping = ShippingLine{
+		Fee:      in.Shipping,
+		Discount: in.Shipping - remaining[shipping],
+		Total:    remaining[shipping],
+	}
+	if in.Shipping > 0 {
+		quote.Shipping.TaxRate = in.Tax.Rate("", in.Regions...)
+		quote.Shipping.Tax = in.Tax.Amount(remaining[shipping], quote.Shipping.TaxRate)
+		quote.Tax += quote.Shipping.Tax
+	}
+	total += remaining[shipping]
+	if total < 0 {
+		total = 0
+	}
+	quote.TaxMode = in.Tax.Mode
+	if quote.TaxMode == tax.Exclusive {
+		total += quote.Tax
+	}
+	quote.Total = total
+
+	return quote, nil
+}
+
+// Reject records campaign as selected but not applied.
+func (q *Quote) Reject(campaignID, name, reason string) {
+	q.RejectedCampaigns = append(q.RejectedCampaigns, RejectedCampaign{
+		CampaignID: campaignID,
+		Name:       name,
+		Reason:     reason,
+	})
+}
+
+// SortCampaigns returns a copy of campaigns in the order they are applied.
+func SortCampaigns(campaigns []models.Campaign, categories []models.CampaignsCategories) []models.Campaign {
+	ranks := make(map[string]int, len(categories))
+	for _, category := range categories {
+		ranks[category.ID] = category.Rank
+	}
+
+	sorted := make([]models.Campaign, len(campaigns))
+	copy(sorted, campaigns)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		a, b := sorted[i], sorted[j]
+		if ranks[a.CampaignCategoryID] != ranks[b.CampaignCategoryID] {
+			return ranks[a.CampaignCategoryID] < ranks[b.CampaignCategoryID]
+		}
+		if a.CampaignCategoryID != b.CampaignCategoryID {
+			return a.CampaignCategoryID < b.CampaignCategoryID
+		}
+		return a.ID < b.ID
+	})
+	return sorted
+}
+
+// FindConflicts reports every exclusive campaign category with more than one
+// selected campaign. Categories are exclusive unless AllowMultiple is set;
+// campaigns without a category never conflict.
+func FindConflicts(campaigns []models.Campaign, categories []models.CampaignsCategories) []CampaignConflict {
+	byID := make(map[string]models.CampaignsCategories, len(categories))
+	for _, category := range categories {
+		byID[category.ID] = category
+	}
+
+	var conflicts []CampaignConflict
+	index := make(map[string]int)
+	for _, campaign := range SortCampaigns(campaigns, categories) {
+		categoryID := campaign.CampaignCategoryID
+		if categoryID == "" || byID[categoryID].AllowMultiple {
+			continue
+		}
+		i, ok := index[categoryID]
+		if !ok {
+			index[categoryID] = len(conflicts)
+			conflicts = append(conflicts, CampaignConflict{
+				CampaignCategoryID:   categoryID,
+				CampaignCategoryName: byID[categoryID].Name,
+			})
+			i = len(conflicts) - 1
+		}
+		conflicts[i].CampaignIDs = append(conflicts[i].CampaignIDs, campaign.ID)
+		conflicts[i].CampaignNames = append(conflicts[i].CampaignNames, campaign.Name)
+	}
+
+	result := []CampaignConflict{}
+	for _, conflict := range conflicts {
+		if len(conflict.CampaignIDs) > 1 {
+			result = append(result, conflict)
+		}
+	}
+	return result
+}
+
+// eligibleLines returns the indexes of the lines a campaign discounts. Percent,
+// fixed and spend-and-save campaigns only cover lines whose product category
+// is one of their ProductCategories; campaigns without targets, and point
+// campaigns, cover the whole cart.
+func eligibleLines(campaign models.Campaign, lines []Line) []int {
+	targets := make(map[string]bool, len(campaign.ProductCategories))
+	if !IsPointCampaign(campaign) {
+		for _, category := range campaign.ProductCategories {
+			targets[category.ID] = true
+		}
+	}
+
+	eligible := make([]int, 0, len(lines))
+	for i, line := range lines {
+		if len(targets) == 0 || targets[line.Product.ProductCategoryID] {
+			eligible = append(eligible, i)
+		}
+	}
+	return eligible
+}
+
+// IsPointCampaign reports whether campaign redeems user points.
+func IsPointCampaign(campaign models.Campaign) bool {
+	return campaign.DiscountType == DiscountPoint || campaign.DiscountType == discountPointAlias
+}
+
+// pointRedemption returns how many of the available points a point campaign
+// redeems against amount. Limit caps the redemption at that percent of amount;
+// a zero Limit allows the whole amount.
+func pointRedemption(campaign models.Campaign, amount money.Money, available int) int {
+	limit := amount
+	if campaign.Limit > 0 && campaign.Limit < money.FromMajor(100) {
+		limit = amount.Percent(campaign.Limit)
+	}
+	redeemed := int(limit / PointValue)
+	if redeemed > available {
+		redeemed = available
+	}
+	if redeemed < 0 {
+		redeemed = 0
+	}
+	return redeemed
+}
+
+// campaignDiscount returns how much a single campaign takes off the given amount.
+func campaignDiscount(campaign models.Campaign, amount money.Money) money.Money {
+	switch campaign.DiscountType {
+	case DiscountPercent:
+		return amount.Percent(campaign.DiscountValue)
+	case DiscountFixed:
+		return campaign.DiscountValue
+	case DiscountSpendAndSave:
+		// Example: Spend 100 save 10
+		if campaign.Every <= 0 || campaign.DiscountValue <= 0 {
+			return 0
+		}
+		discount := campaign.DiscountValue.Mul(int64(amount / campaign.Every))
+		if campaign.Limit > 0 && discount > campaign.Limit {
+			discount = campaign.Limit
+		}
+		return discount
+	}
+	return 0
+}
@@ -0,0 +1,315 @@
+package pricing
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/faiisu/ecom-backend/internal/models"
+	"github.com/faiisu/ecom-backend/internal/money"
+	"github.com/faiisu/ecom-backend/internal/tax"
+)
+
+func baht(v int64) money.Money { return money.FromMajor(v) }
+
+func line(id, categoryID string, price int64, quantity int) Line {
+	return Line{
+		Product:  models.Product{ID: id, ProductCategoryID: categoryID, Price: baht(price), IsActive: true},
+		Quantity: quantity,
+	}
+}
+
+func campaign(id, discountType string, value int64) models.Campaign {
+	return models.Campaign{ID: id, Name: id, DiscountType: discountType, DiscountValue: baht(value), IsActive: true}
+}
+
+// cart is ฿1000: ฿600 of category a and ฿400 of category b.
+var cart = []Line{line("p1", "a", 300, 2), line("p2", "b", 200, 2)}
+
+func TestCalculate(t *testing.T) {
+	spendAndSave := func(every, save, limit int64) models.Campaign {
+		c := campaign("sas", DiscountSpendAndSave, save)
+		c.Every, c.Limit = baht(every), baht(limit)
+		return c
+	}
+	points := func(limit int64) models.Campaign {
+		c := campaign("pts", DiscountPoint, 0)
+		c.Limit = baht(limit)
+		return c
+	}
+	inCategory := func(c models.Campaign, categoryID string) models.Campaign {
+		c.CampaignCategoryID = categoryID
+		return c
+	}
+	targeting := func(c models.Campaign, ids ...string) models.Campaign {
+		for _, id := range ids {
+			c.ProductCategories = append(c.ProductCategories, models.ProductCategory{ID: id})
+		}
+		return c
+	}
+	inactive := campaign("off", DiscountFixed, 100)
+	inactive.IsActive = false
+	ranks := []models.CampaignsCategories{
+		{ID: "first", Rank: 1, AllowMultiple: true},
+		{ID: "second", Rank: 2, AllowMultiple: true},
+	}
+
+	tests := []struct {
+		name       string
+		campaigns  []models.Campaign
+		categories []models.CampaignsCategories
+		balance    int
+		pointUsed  int
+		wantTotal  money.Money
+		wantPoints int
+		wantApply  []money.Money // amount of each applied campaign, in order
+		wantReject []string      // reasons, in order
+	}{
+		{name: "no campaigns", wantTotal: baht(1000)},
+		{name: "percent", campaigns: []models.Campaign{campaign("pct", DiscountPercent, 10)},
+			wantTotal: baht(900), wantApply: []money.Money{baht(100)}},
+		{name: "fixed", campaigns: []models.Campaign{campaign("fix", DiscountFixed, 50)},
+			wantTotal: baht(950), wantApply: []money.Money{baht(50)}},
+		{name: "fixed over the total stops at zero", campaigns: []models.Campaign{campaign("fix", DiscountFixed, 1500)},
+			wantTotal: 0, wantApply: []money.Money{baht(1000)}},
+		{name: "spend and save every", campaigns: []models.Campaign{spendAndSave(300, 40, 0)},
+			wantTotal: baht(880), wantApply: []money.Money{baht(120)}},
+		{name: "spend and save up to its limit", campaigns: []models.Campaign{spendAndSave(300, 40, 100)},
+			wantTotal: baht(900), wantApply: []money.Money{baht(100)}},
+		{name: "spend and save not reached", campaigns: []models.Campaign{spendAndSave(2000, 40, 0)},
+			wantTotal: baht(1000), wantReject: []string{ReasonNotQualified}},
+		{name: "points up to the limit percent", campaigns: []models.Campaign{points(20)}, balance: 500,
+			wantTotal: baht(800), wantPoints: 200, wantApply: []money.Money{baht(200)}},
+		{name: "points up to the balance", campaigns: []models.Campaign{points(20)}, balance: 150,
+			wantTotal: baht(850), wantPoints: 150, wantApply: []money.Money{baht(150)}},
+		{name: "points up to point_used", campaigns: []models.Campaign{points(20)}, balance: 500, pointUsed: 80,
+			wantTotal: baht(920), wantPoints: 80, wantApply: []money.Money{baht(80)}},
+		{name: "points without a limit stop at zero", campaigns: []models.Campaign{points(0)}, balance: 5000,
+			wantTotal: 0, wantPoints: 1000, wantApply: []money.Money{baht(1000)}},
+		{name: "points with no balance", campaigns: []models.Campaign{points(20)},
+			wantTotal: baht(1000), wantReject: []string{ReasonNotQualified}},
+		{
+			name: "lower rank applies first",
+			campaigns: []models.Campaign{
+				inCategory(campaign("pct", DiscountPercent, 10), "second"),
+				inCategory(campaign("fix", DiscountFixed, 100), "first"),
+			},
+			categories: ranks,
+			wantTotal:  baht(810),
+			wantApply:  []money.Money{baht(100), baht(90)},
+		},
+		{
+			name: "rank order reversed",
+			campaigns: []models.Campaign{
+				inCategory(campaign("pct", DiscountPercent, 10), "first"),
+				inCategory(campaign("fix", DiscountFixed, 100), "second"),
+			},
+			categories: ranks,
+			wantTotal:  baht(800),
+			wantApply:  []money.Money{baht(100), baht(100)},
+		},
+		{name: "target category", campaigns: []models.Campaign{targeting(campaign("pct", DiscountPercent, 50), "b")},
+			wantTotal: baht(800), wantApply: []money.Money{baht(200)}},
+		{name: "target category not in the cart", campaigns: []models.Campaign{targeting(campaign("pct", DiscountPercent, 50), "c")},
+			wantTotal: baht(1000), wantReject: []string{ReasonNoEligibleItems}},
+		{name: "inactive", campaigns: []models.Campaign{inactive},
+			wantTotal: baht(1000), wantReject: []string{ReasonInactive}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			quote, err := Calculate(Input{
+				Lines:      cart,
+				User:       models.User{ID: "u1", Point: tt.balance},
+				Campaigns:  tt.campaigns,
+				Categories: tt.categories,
+				PointUsed:  tt.pointUsed,
+			})
+			if err != nil {
+				t.Fatalf("Calculate: %v", err)
+			}
+			if quote.Subtotal != baht(1000) {
+				t.Errorf("subtotal = %s, want 1000", quote.Subtotal)
+			}
+			if quote.Total != tt.wantTotal {
+				t.Errorf("total = %s, want %s", quote.Total, tt.wantTotal)
+			}
+			if quote.PointUsed != tt.wantPoints {
+				t.Errorf("point_used = %d, want %d", quote.PointUsed, tt.wantPoints)
+			}
+
+			applied := []money.Money{}
+			for _, c := range quote.Campaigns {
+				applied = append(applied, c.Amount)
+			}
+			if tt.wantApply == nil {
+				tt.wantApply = []money.Money{}
+			}
+			if !reflect.DeepEqual(applied, tt.wantApply) {
+				t.Errorf("applied = %v, want %v", applied, tt.wantApply)
+			}
+			rejected := []string{}
+			for _, r := range quote.RejectedCampaigns {
+				rejected = append(rejected, r.Reason)
+			}
+			if tt.wantReject == nil {
+				tt.wantReject = []string{}
+			}
+			if !reflect.DeepEqual(rejected, tt.wantReject) {
+				t.Errorf("rejected = %v, want %v", rejected, tt.wantReject)
+			}
+
+			var lines money.Money
+			for _, l := range quote.Lines {
+				lines += l.Total
+			}
+			if lines != quote.Total {
+				t.Errorf("lines add up to %s, total is %s", lines, quote.Total)
+			}
+		})
+	}
+}
+
+func TestCalculateTargetLinesOnly(t *testing.T) {
+	pct := campaign("pct", DiscountPercent, 50)
+	pct.ProductCategories = []models.ProductCategory{{ID: "b"}}
+	quote, err := Calculate(Input{Lines: cart, Campaigns: []models.Campaign{pct}})
+	if err != nil {
+		t.Fatalf("Calculate: %v", err)
+	}
+	if got := quote.Lines[0].Discount; got != 0 {
+		t.Errorf("line outside the target got %s off", got)
+	}
+	if got := quote.Lines[1].Discount; got != baht(200) {
+		t.Errorf("target line got %s off, want 200", got)
+	}
+}
+
+func TestCalculateErrors(t *testing.T) {
+	exclusive := []models.CampaignsCategories{{ID: "x"}}
+	one, two := campaign("one", DiscountFixed, 10), campaign("two", DiscountFixed, 20)
+	one.CampaignCategoryID, two.CampaignCategoryID = "x", "x"
+
+	tests := []struct {
+		name string
+		in   Input
+		want error
+	}{
+		{name: "empty cart", in: Input{}, want: ErrEmptyCart},
+		{name: "more points than the balance", in: Input{Lines: cart, User: models.User{Point: 10}, PointUsed: 11}, want: ErrInsufficientPoints},
+		{name: "negative points", in: Input{Lines: cart, User: models.User{Point: 10}, PointUsed: -5}, want: ErrNegativePoints},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Calculate(tt.in); !errors.Is(err, tt.want) {
+				t.Errorf("err = %v, want %v", err, tt.want)
+			}
+		})
+	}
+
+	t.Run("exclusive category", func(t *testing.T) {
+		_, err := Calculate(Input{Lines: cart, Campaigns: []models.Campaign{one, two}, Categories: exclusive})
+		var conflictErr *ConflictError
+		if !errors.As(err, &conflictErr) {
+			t.Fatalf("err = %v, want a ConflictError", err)
+		}
+		if len(conflictErr.Conflicts) != 1 {
+			t.Errorf("conflicts = %+v, want one", conflictErr.Conflicts)
+		}
+	})
+}
+
+func TestFindConflicts(t *testing.T) {
+	inCategory := func(id, categoryID string) models.Campaign {
+		c := campaign(id, DiscountFixed, 10)
+		c.CampaignCategoryID = categoryID
+		return c
+	}
+	categories := []models.CampaignsCategories{
+		{ID: "excl", Name: "Exclusive", Rank: 1},
+		{ID: "multi", Name: "Multiple", Rank: 2, AllowMultiple: true},
+		{ID: "other", Name: "Other", Rank: 3},
+	}
+
+	tests := []struct {
+		name      string
+		campaigns []models.Campaign
+		want      [][]string // campaign IDs of each conflict
+	}{
+		{name: "none selected"},
+		{name: "one per exclusive category", campaigns: []models.Campaign{inCategory("a", "excl"), inCategory("b", "other")}},
+		{name: "two in an exclusive category", campaigns: []models.Campaign{inCategory("a", "excl"), inCategory("b", "excl")},
+			want: [][]string{{"a", "b"}}},
+		{name: "allow multiple", campaigns: []models.Campaign{inCategory("a", "multi"), inCategory("b", "multi")}},
+		{name: "no category", campaigns: []models.Campaign{inCategory("a", ""), inCategory("b", "")}},
+		{
+			name: "two exclusive categories",
+			campaigns: []models.Campaign{
+				inCategory("d", "other"), inCategory("a", "excl"), inCategory("c", "other"), inCategory("b", "excl"),
+			},
+			want: [][]string{{"a", "b"}, {"c", "d"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := [][]string{}
+			for _, conflict := range FindConflicts(tt.campaigns, categories) {
+				got = append(got, conflict.CampaignIDs)
+			}
+			if tt.want == nil {
+				tt.want = [][]string{}
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("conflicts = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCalculateTax(t *testing.T) {
+	rates := func(mode string) tax.Table {
+		return tax.Table{Mode: mode, Default: baht(7), Rules: []tax.Rule{
+			{CategoryID: "b", Rate: 0},
+			{Region: "Phuket", Rate: baht(8)},
+		}}
+	}
+
+	tests := []struct {
+		name      string
+		mode      string
+		campaigns []models.Campaign
+		shipping  money.Money
+		regions   []string
+		wantTax   money.Money
+		wantTotal money.Money
+	}{
+		{name: "inclusive", mode: tax.Inclusive, wantTax: 3925, wantTotal: baht(1000)},
+		{name: "exclusive", mode: tax.Exclusive, wantTax: baht(42), wantTotal: baht(1042)},
+		{name: "exclusive after discounts", mode: tax.Exclusive, campaigns: []models.Campaign{campaign("pct", DiscountPercent, 10)},
+			wantTax: 3780, wantTotal: 93780},
+		{name: "inclusive shipping", mode: tax.Inclusive, shipping: baht(50), wantTax: 3925 + 327, wantTotal: baht(1050)},
+		{name: "exclusive shipping", mode: tax.Exclusive, shipping: baht(50), wantTax: 4550, wantTotal: 109550},
+		{name: "region rule", mode: tax.Exclusive, shipping: baht(50), regions: []string{"Phuket"}, wantTax: baht(52), wantTotal: baht(1102)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			quote, err := Calculate(Input{
+				Lines:     cart,
+				Campaigns: tt.campaigns,
+				Shipping:  tt.shipping,
+				Tax:       rates(tt.mode),
+				Regions:   tt.regions,
+			})
+			if err != nil {
+				t.Fatalf("Calculate: %v", err)
+			}
+			if quote.TaxMode != tt.mode {
+				t.Errorf("tax_mode = %q, want %q", quote.TaxMode, tt.mode)
+			}
+			if quote.Tax != tt.wantTax || quote.Total != tt.wantTotal {
+				t.Errorf("tax %s total %s, want tax %s total %s", quote.Tax, quote.Total, tt.wantTax, tt.wantTotal)
+			}
+		})
+	}
+}
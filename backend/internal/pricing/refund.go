@@ -0,0 +1,88 @@
+package pricing
+
+import (
+	"fmt"
+
+	"github.com/faiisu/ecom-backend/internal/models"
+	"github.com/faiisu/ecom-backend/internal/tax"
+)
+
+// RepriceOrder prices what is left of order after a partial refund. keep maps
+// a product ID to the quantity the customer still has; products missing from
+// keep are dropped. The order's snapshot prices and campaign terms are used,
+// not the current catalog, and campaigns are applied in their original order
+// with no more points than were redeemed the first time. A campaign the
+// smaller order no longer qualifies for drops out, so the refund gives back
+// the discount it had earned. The shipping fee stays with the order as long
+// as any item is kept, so only cancellations and full refunds return it. Tax
+// uses the rates the order was charged: each item its own, and the shipping
+// fee its rate.
+func RepriceOrder(order models.Order, keep map[string]int) (Quote, error) {
+	rates := tax.Table{Mode: order.TaxMode, Default: order.ShippingTaxRate}
+	lines := make([]Line, 0, len(order.Items))
+	for _, item := range order.Items {
+		quantity := keep[item.ProductID]
+		if quantity <= 0 {
+			continue
+		}
+		lines = append(lines, Line{
+			Product: models.Product{
+				ID:                  item.ProductID,
+				Name:                item.ProductName,
+				ProductCategoryID:   item.ProductCategoryID,
+				ProductCategoryName: item.ProductCategoryName,
+				Price:               item.UnitPrice,
+				IsActive:            true,
+			},
+			Quantity: quantity,
+			TaxRate:  &item.TaxRate,
+		})
+	}
+	if len(lines) == 0 {
+		return Quote{
+			Lines:             []QuoteLine{},
+			Campaigns:         []CampaignDiscount{},
+			RejectedCampaigns: []RejectedCampaign{},
+		}, nil
+	}
+
+	// Each campaign gets a category of its own ranked by its position in the
+	// order, which keeps the original sequence and skips exclusivity checks
+	// that already passed at checkout.
+	campaigns := make([]models.Campaign, 0, len(order.Campaigns))
+	categories := make([]models.CampaignsCategories, 0, len(order.Campaigns))
+	for i, applied := range order.Campaigns {
+		categoryID := fmt.Sprintf("%06d", i)
+		targets := make([]models.ProductCategory, 0, len(applied.ProductCategoryIDs))
+		for _, id := range applied.ProductCategoryIDs {
+			targets = append(targets, models.ProductCategory{ID: id})
+		}
+		campaigns = append(campaigns, models.Campaign{
+			ID:                 applied.CampaignID,
+			Name:               applied.Name,
+			DiscountType:       applied.DiscountType,
+			DiscountValue:      applied.DiscountValue,
+			Limit:              applied.Limit,
+			Every:              applied.Every,
+			CampaignCategoryID: categoryID,
+			ShippingScope:      applied.ShippingScope,
+			IsActive:           true,
+			ProductCategories:  targets,
+		})
+		categories = append(categories, models.CampaignsCategories{
+			ID:            categoryID,
+			Rank:          i,
+			AllowMultiple: true,
+		})
+	}
+
+	return Calculate(Input{
+		Lines:      lines,
+		User:       models.User{ID: order.UserID, Point: order.PointUsed},
+		Campaigns:  campaigns,
+		Categories: categories,
+		PointUsed:  order.PointUsed,
+		Shipping:   order.ShippingFee,
+		Tax:        rates,
+	})
+}
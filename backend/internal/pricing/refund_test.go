@@ -0,0 +1,55 @@
+package pricing
+
+import (
+	"testing"
+
+	"github.com/faiisu/ecom-backend/internal/models"
+	"github.com/faiisu/ecom-backend/internal/money"
+	"github.com/faiisu/ecom-backend/internal/tax"
+)
+
+func TestRepriceOrderTax(t *testing.T) {
+	// Exclusive 7% on an uncategorized item and 0% on a book, nothing shipped
+	rates := tax.Table{Mode: tax.Exclusive, Default: baht(7), Rules: []tax.Rule{{CategoryID: "books", Rate: 0}}}
+	quote, err := Calculate(Input{
+		Lines: []Line{line("mug", "", 100, 2), line("novel", "books", 300, 1)},
+		Tax:   rates,
+	})
+	if err != nil {
+		t.Fatalf("Calculate: %v", err)
+	}
+
+	order := models.Order{TaxMode: quote.TaxMode, Tax: quote.Tax, Total: quote.Total}
+	for _, l := range quote.Lines {
+		order.Items = append(order.Items, models.OrderItem{
+			ProductID:         l.ProductID,
+			ProductCategoryID: l.ProductCategoryID,
+			UnitPrice:         l.UnitPrice,
+			Quantity:          l.Quantity,
+			TaxRate:           l.TaxRate,
+			Tax:               l.Tax,
+		})
+	}
+
+	tests := []struct {
+		name      string
+		keep      map[string]int
+		wantTax   money.Money
+		wantTotal money.Money
+	}{
+		{name: "everything", keep: map[string]int{"mug": 2, "novel": 1}, wantTax: quote.Tax, wantTotal: quote.Total},
+		{name: "uncategorized item keeps its rate", keep: map[string]int{"mug": 1}, wantTax: baht(7), wantTotal: baht(107)},
+		{name: "zero rated item", keep: map[string]int{"novel": 1}, wantTax: 0, wantTotal: baht(300)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			kept, err := RepriceOrder(order, tt.keep)
+			if err != nil {
+				t.Fatalf("RepriceOrder: %v", err)
+			}
+			if kept.Tax != tt.wantTax || kept.Total != tt.wantTotal {
+				t.Errorf("tax %s total %s, want tax %s total %s", kept.Tax, kept.Total, tt.wantTax, tt.wantTotal)
+			}
+		})
+	}
+}
@@ -0,0 +1,90 @@
+package receipt
+
+import (
+	"html/template"
+	"io"
+)
+
+var htmlTemplate = template.Must(template.New("receipt").Funcs(template.FuncMap{
+	"amount": formatAmount,
+	"rate":   formatRate,
+}).Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>Receipt {{.InvoiceNumber}}</title>
+<style>
+body { font-family: sans-serif; max-width: 720px; margin: 2em auto; color: #222; }
+table { width: 100%; border-collapse: collapse; margin: 1em 0; }
+th, td { padding: 4px 6px; border-bottom: 1px solid #ddd; text-align: left; }
+td.num, th.num { text-align: right; }
+.totals td { border: none; }
+.grand td { font-weight: bold; border-top: 2px solid #222; }
+</style>
+</head>
+<body>
+<h1>Receipt</h1>
+<p>
+Invoice no. <strong>{{.InvoiceNumber}}</strong><br>
+Order {{.OrderID}}<br>
+Customer {{.UserID}}<br>
+Issued {{.IssuedAt.Format "2006-01-02 15:04 MST"}}
+</p>
+{{- if .ShipTo}}
+<p>
+Ship to<br>
+{{- range .ShipTo}}
+{{.}}<br>
+{{- end}}
+</p>
+{{- end}}
+<table>
+<thead><tr><th>Item</th><th class="num">Qty</th><th class="num">Unit price</th><th class="num">Amount</th><th class="num">Discount</th><th class="num">Total</th><th class="num">VAT</th></tr></thead>
+<tbody>
+{{- range .Lines}}
+<tr><td>{{.Name}}</td><td class="num">{{.Quantity}}</td><td class="num">{{amount .UnitPrice}}</td><td class="num">{{amount .LineTotal}}</td><td class="num">{{amount .Discount}}</td><td class="num">{{amount .Total}}</td><td class="num">{{rate .TaxRate}}</td></tr>
+{{- end}}
+</tbody>
+</table>
+{{- if .Campaigns}}
+<h2>Campaigns applied</h2>
+<table>
+<tbody>
+{{- range .Campaigns}}
+<tr><td>{{.Name}}</td><td class="num">-{{amount .Amount}}</td></tr>
+{{- end}}
+</tbody>
+</table>
+{{- end}}
+<table class="totals">
+<tr><td>Subtotal</td><td class="num">{{amount .Subtotal}}</td></tr>
+{{- if .ShippingFee}}
+<tr><td>Shipping</td><td class="num">{{amount .ShippingFee}}</td></tr>
+{{- end}}
+<tr><td>Discount</td><td class="num">-{{amount .Discount}}</td></tr>
+{{- if .PointUsed}}
+<tr><td>Points redeemed ({{.PointUsed}}, included in discount)</td><td class="num">-{{amount .PointDiscount}}</td></tr>
+{{- end}}
+{{- if .Exclusive}}
+{{- range .Taxes}}
+<tr><td>VAT {{rate .Rate}}</td><td class="num">{{amount .Amount}}</td></tr>
+{{- end}}
+{{- end}}
+<tr class="grand"><td>Total</td><td class="num">{{amount .Total}}</td></tr>
+{{- if not .Exclusive}}
+{{- range .Taxes}}
+<tr><td>VAT {{rate .Rate}} included</td><td class="num">{{amount .Amount}}</td></tr>
+{{- end}}
+{{- end}}
+{{- if .Refunded}}
+<tr><td>Refunded</td><td class="num">-{{amount .Refunded}}</td></tr>
+{{- end}}
+</table>
+</body>
+</html>
+`))
+
+// WriteHTML renders r as a standalone HTML page.
+func WriteHTML(w io.Writer, r Receipt) error {
+	return htmlTemplate.Execute(w, r)
+}
@@ -0,0 +1,108 @@
+package receipt
+
+import (
+	"io"
+	"strconv"
+
+	"github.com/go-pdf/fpdf"
+)
+
+// WritePDF renders r as an A4 PDF. It uses the PDF core fonts, which only
+// cover Western European (cp1252) text; other characters in product or
+// campaign names are printed as ".". The HTML receipt has no such limit.
+func WritePDF(w io.Writer, r Receipt) error {
+	pdf := fpdf.New("P", "mm", "A4", "")
+	pdf.SetTitle("Receipt "+r.InvoiceNumber, true)
+	pdf.SetCreationDate(r.IssuedAt)
+	pdf.SetMargins(15, 15, 15)
+	pdf.SetAutoPageBreak(true, 15)
+	pdf.AddPage()
+	tr := pdf.UnicodeTranslatorFromDescriptor("")
+
+	pdf.SetFont("Helvetica", "B", 18)
+	pdf.CellFormat(0, 10, "Receipt", "", 1, "L", false, 0, "")
+
+	pdf.SetFont("Helvetica", "", 10)
+	for _, text := range []string{
+		"Invoice no. " + r.InvoiceNumber,
+		"Order " + r.OrderID,
+		"Customer " + r.UserID,
+		"Issued " + r.IssuedAt.Format("2006-01-02 15:04 MST"),
+	} {
+		pdf.CellFormat(0, 5, tr(text), "", 1, "L", false, 0, "")
+	}
+	if len(r.ShipTo) > 0 {
+		pdf.Ln(2)
+		pdf.CellFormat(0, 5, "Ship to", "", 1, "L", false, 0, "")
+		for _, text := range r.ShipTo {
+			pdf.CellFormat(0, 5, tr(text), "", 1, "L", false, 0, "")
+		}
+	}
+	pdf.Ln(4)
+
+	// Item lines
+	widths := []float64{62, 10, 23, 23, 22, 23, 17}
+	pdf.SetFont("Helvetica", "B", 9)
+	for i, header := range []string{"Item", "Qty", "Unit price", "Amount", "Discount", "Total", "VAT"} {
+		align := "R"
+		if i == 0 {
+			align = "L"
+		}
+		pdf.CellFormat(widths[i], 7, header, "B", 0, align, false, 0, "")
+	}
+	pdf.Ln(-1)
+	pdf.SetFont("Helvetica", "", 9)
+	for _, line := range r.Lines {
+		pdf.CellFormat(widths[0], 6, tr(line.Name), "", 0, "L", false, 0, "")
+		pdf.CellFormat(widths[1], 6, strconv.Itoa(line.Quantity), "", 0, "R", false, 0, "")
+		pdf.CellFormat(widths[2], 6, line.UnitPrice.String(), "", 0, "R", false, 0, "")
+		pdf.CellFormat(widths[3], 6, line.LineTotal.String(), "", 0, "R", false, 0, "")
+		pdf.CellFormat(widths[4], 6, line.Discount.String(), "", 0, "R", false, 0, "")
+		pdf.CellFormat(widths[5], 6, line.Total.String(), "", 0, "R", false, 0, "")
+		pdf.CellFormat(widths[6], 6, formatRate(line.TaxRate), "", 1, "R", false, 0, "")
+	}
+	pdf.Ln(4)
+
+	if len(r.Campaigns) > 0 {
+		pdf.SetFont("Helvetica", "B", 10)
+		pdf.CellFormat(0, 7, "Campaigns applied", "", 1, "L", false, 0, "")
+		pdf.SetFont("Helvetica", "", 9)
+		for _, campaign := range r.Campaigns {
+			pdfRow(pdf, tr(campaign.Name), "-"+formatAmount(campaign.Amount))
+		}
+		pdf.Ln(4)
+	}
+
+	pdfRow(pdf, "Subtotal", formatAmount(r.Subtotal))
+	if r.ShippingFee > 0 {
+		pdfRow(pdf, "Shipping", formatAmount(r.ShippingFee))
+	}
+	pdfRow(pdf, "Discount", "-"+formatAmount(r.Discount))
+	if r.PointUsed > 0 {
+		pdfRow(pdf, "Points redeemed ("+strconv.Itoa(r.PointUsed)+", included in discount)", "-"+formatAmount(r.PointDiscount))
+	}
+	if r.Exclusive() {
+		for _, t := range r.Taxes {
+			pdfRow(pdf, "VAT "+formatRate(t.Rate), formatAmount(t.Amount))
+		}
+	}
+	pdf.SetFont("Helvetica", "B", 10)
+	pdfRow(pdf, "Total", formatAmount(r.Total))
+	pdf.SetFont("Helvetica", "", 9)
+	if !r.Exclusive() {
+		for _, t := range r.Taxes {
+			pdfRow(pdf, "VAT "+formatRate(t.Rate)+" included", formatAmount(t.Amount))
+		}
+	}
+	if r.Refunded > 0 {
+		pdfRow(pdf, "Refunded", "-"+formatAmount(r.Refunded))
+	}
+
+	return pdf.Output(w)
+}
+
+// pdfRow prints a label with an amount right-aligned beside it.
+func pdfRow(pdf *fpdf.Fpdf, label, amount string) {
+	pdf.CellFormat(140, 6, label, "", 0, "L", false, 0, "")
+	pdf.CellFormat(40, 6, amount, "", 1, "R", false, 0, "")
+}
@@ -0,0 +1,145 @@
+// Package receipt renders an order snapshot as a customer receipt, in HTML
+// or PDF. It works only from the stored order, never the current catalog, so
+// a receipt printed later shows exactly what was charged.
+package receipt
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/faiisu/ecom-backend/internal/models"
+	"github.com/faiisu/ecom-backend/internal/money"
+	"github.com/faiisu/ecom-backend/internal/tax"
+)
+
+// Receipt is what both renderers print.
+type Receipt struct {
+	InvoiceNumber string
+	OrderID       string
+	UserID        string
+	Status        string
+	IssuedAt      time.Time
+	Lines         []Line
+	Campaigns     []Campaign
+	ShipTo        []string // address lines, empty when nothing was shipped
+	Subtotal      money.Money
+	ShippingFee   money.Money
+	Discount      money.Money
+	PointUsed     int
+	PointDiscount money.Money
+	Total         money.Money
+	TaxMode       string
+	Taxes         []Tax // per rate, lowest first
+	Refunded      money.Money
+}
+
+// Exclusive reports whether the taxes were added to the prices.
+func (r Receipt) Exclusive() bool { return r.TaxMode == tax.Exclusive }
+
+// Tax is the tax charged at one rate.
+type Tax struct {
+	Rate   money.Money
+	Amount money.Money
+}
+
+type Line struct {
+	Name      string
+	Quantity  int
+	UnitPrice money.Money
+	LineTotal money.Money
+	Discount  money.Money
+	Total     money.Money
+	TaxRate   money.Money
+}
+
+type Campaign struct {
+	Name   string
+	Amount money.Money
+}
+
+// New builds the receipt for order from the tax it was charged. Orders placed
+// before tax was stored get the share of their total that fallbackRate (a
+// percent) accounts for, as prices were tax inclusive then.
+func New(order models.Order, fallbackRate money.Money) Receipt {
+	r := Receipt{
+		InvoiceNumber: order.InvoiceNumber,
+		OrderID:       order.ID,
+		UserID:        order.UserID,
+		Status:        order.Status,
+		IssuedAt:      order.CreatedAt,
+		Subtotal:      order.Subtotal,
+		ShippingFee:   order.ShippingFee,
+		Discount:      order.Discount,
+		PointUsed:     order.PointUsed,
+		PointDiscount: order.PointDiscount,
+		Total:         order.Total,
+		TaxMode:       order.TaxMode,
+		Refunded:      order.RefundedTotal,
+	}
+	for _, change := range order.StatusHistory {
+		if change.Status == models.OrderPaid {
+			r.IssuedAt = change.At
+			break
+		}
+	}
+	for _, item := range order.Items {
+		r.Lines = append(r.Lines, Line{
+			Name:      item.ProductName,
+			Quantity:  item.Quantity,
+			UnitPrice: item.UnitPrice,
+			LineTotal: item.LineTotal,
+			Discount:  item.Discount,
+			Total:     item.Total,
+			TaxRate:   item.TaxRate,
+		})
+	}
+
+	if order.TaxMode == "" {
+		r.TaxMode = tax.Inclusive
+		r.Taxes = []Tax{{Rate: fallbackRate, Amount: order.Total.IncludedTax(fallbackRate)}}
+		for i := range r.Lines {
+			r.Lines[i].TaxRate = fallbackRate
+		}
+	} else {
+		byRate := map[money.Money]money.Money{}
+		for _, item := range order.Items {
+			byRate[item.TaxRate] += item.Tax
+		}
+		if order.ShippingFee > 0 {
+			byRate[order.ShippingTaxRate] += order.ShippingTax
+		}
+		for rate, amount := range byRate {
+			r.Taxes = append(r.Taxes, Tax{Rate: rate, Amount: amount})
+		}
+		sort.Slice(r.Taxes, func(i, j int) bool { return r.Taxes[i].Rate < r.Taxes[j].Rate })
+	}
+	for _, campaign := range order.Campaigns {
+		r.Campaigns = append(r.Campaigns, Campaign{Name: campaign.Name, Amount: campaign.Amount})
+	}
+	if a := order.ShippingAddress; a != nil {
+		r.ShipTo = []string{a.Recipient, a.Line1}
+		if a.Line2 != "" {
+			r.ShipTo = append(r.ShipTo, a.Line2)
+		}
+		area := a.Province + " " + a.PostalCode
+		if a.District != "" {
+			area = a.District + ", " + area
+		}
+		r.ShipTo = append(r.ShipTo, area, a.Country)
+	}
+	return r
+}
+
+// formatAmount prints m for a receipt.
+func formatAmount(m money.Money) string {
+	return "THB " + m.String()
+}
+
+// formatRate prints a percent without trailing zeros.
+func formatRate(rate money.Money) string {
+	if rate%money.Scale == 0 {
+		return fmt.Sprintf("%d%%", rate/money.Scale)
+	}
+	return rate.String() + "%"
+}
@@ -9,8 +9,11 @@ func SetupRoutes(app *fiber.App) {
 	app.Get("/health", handlers.HealthCheck)
 
 	app.Post("/guestregister", handlers.GuestRegister)
+	app.Post("/users/:id/merge", handlers.MergeGuest)
 	app.Post("/products", handlers.AddProduct)
 	app.Get("/products", handlers.GetProducts)
+	app.Patch("/products/:id/stock", handlers.AdjustStock)
+	app.Get("/products/:id/stock/movements", handlers.GetStockMovements)
 	app.Post("/campaigns", handlers.AddCampaign)
 	app.Get("/campaigns", handlers.GetCampaigns)
 	app.Delete("/campaigns/:id", handlers.DeleteCampaign)
@@ -20,9 +23,29 @@ func SetupRoutes(app *fiber.App) {
 	app.Delete("/product-categories/:id", handlers.DeleteProductCategory)
 	app.Post("/campaign-categories", handlers.AddCampaignCategory)
 	app.Patch("/campaign-categories/realign", handlers.RealignCampaignCategoryRanks)
+	app.Patch("/campaign-categories/:id/exclusivity", handlers.UpdateCampaignCategoryExclusivity)
 	app.Get("/campaign-categories", handlers.GetCampaignCategories)
 	app.Post("/cart", handlers.AddCartItem)
+	app.Patch("/cart", handlers.SetCartItem)
 	app.Get("/cart/:user_id", handlers.GetCartItems)
+	app.Get("/cart/:user_id/campaigns", handlers.GetCartCampaigns)
+	app.Post("/cart/:user_id/campaigns", handlers.AttachCartCampaign)
+	app.Delete("/cart/:user_id/campaigns/:campaign_id", handlers.DetachCartCampaign)
 	app.Delete("/cart", handlers.DeleteCartItem)
-	app.Post("/checkout", handlers.Checkout)
+	app.Post("/checkout/preview", handlers.PreviewCheckout)
+	app.Post("/checkout/reservations", handlers.ReserveCartStock)
+	app.Delete("/checkout/reservations/:user_id", handlers.ReleaseCartStock)
+	app.Post("/checkout", handlers.IdempotencyKey, handlers.Checkout)
+	app.Get("/users/:id/orders", handlers.GetUserOrders)
+	app.Get("/users/:id/addresses", handlers.GetUserAddresses)
+	app.Post("/users/:id/addresses", handlers.AddUserAddress)
+	app.Patch("/users/:id/addresses/:address_id", handlers.UpdateUserAddress)
+	app.Delete("/users/:id/addresses/:address_id", handlers.DeleteUserAddress)
+	app.Get("/orders/:id", handlers.GetOrder)
+	app.Patch("/orders/:id/status", handlers.UpdateOrderStatus)
+	app.Get("/orders/:id/receipt", handlers.GetOrderReceipt)
+	app.Post("/orders/:id/cancel", handlers.CancelOrder)
+	app.Post("/orders/:id/refunds", handlers.RefundOrder)
+	app.Get("/orders/:id/refunds", handlers.GetOrderRefunds)
+	app.Post("/payments/webhook", handlers.PaymentWebhook)
 }
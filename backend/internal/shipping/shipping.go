@@ -0,0 +1,121 @@
+// Package shipping prices the delivery of an order. A Calculator turns a
+// parcel into a fee; the rules here can be combined, and Parse builds one
+// from a config string so the rates can change without a release.
+package shipping
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/faiisu/ecom-backend/internal/models"
+	"github.com/faiisu/ecom-backend/internal/money"
+)
+
+// Parcel is what is being shipped and where to.
+type Parcel struct {
+	Address     models.Address
+	Subtotal    money.Money // item total before discounts
+	WeightGrams int
+	Items       int
+}
+
+// Calculator prices the delivery of a parcel.
+type Calculator interface {
+	Fee(p Parcel) money.Money
+}
+
+// Free ships everything at no charge.
+type Free struct{}
+
+func (Free) Fee(Parcel) money.Money { return 0 }
+
+// FlatRate charges the same fee for every parcel.
+type FlatRate struct {
+	Amount money.Money
+}
+
+func (r FlatRate) Fee(Parcel) money.Money { return r.Amount }
+
+// WeightBased charges Base plus PerKg for every started kilogram, so 1001 g
+// is charged as 2 kg. Products without a weight count as 0 g.
+type WeightBased struct {
+	Base  money.Money
+	PerKg money.Money
+}
+
+func (r WeightBased) Fee(p Parcel) money.Money {
+	kg := (p.WeightGrams + 999) / 1000
+	return r.Base + r.PerKg.Mul(int64(kg))
+}
+
+// FreeOver ships parcels whose subtotal reaches Threshold for free and
+// prices the rest with Next.
+type FreeOver struct {
+	Threshold money.Money
+	Next      Calculator
+}
+
+func (r FreeOver) Fee(p Parcel) money.Money {
+	if p.Subtotal >= r.Threshold || r.Next == nil {
+		return 0
+	}
+	return r.Next.Fee(p)
+}
+
+// Parse builds a calculator from a comma separated list of rules, read left
+// to right, for example:
+//
+//	free                    no fee
+//	flat:50                 50 per parcel
+//	weight:30+15            30 plus 15 per started kg
+//	free_over:1000,flat:50  free from 1000, otherwise 50
+//
+// An empty spec is Free.
+func Parse(spec string) (Calculator, error) {
+	spec = strings.TrimSpace(spec)
+	if spec == "" {
+		return Free{}, nil
+	}
+	rule, rest, _ := strings.Cut(spec, ",")
+	name, arg, _ := strings.Cut(strings.TrimSpace(rule), ":")
+
+	switch name {
+	case "free":
+		return Free{}, nil
+	case "flat":
+		amount, err := money.Parse(arg)
+		if err != nil || amount < 0 {
+			return nil, fmt.Errorf("shipping: invalid flat rate %q", arg)
+		}
+		return FlatRate{Amount: amount}, nil
+	case "weight":
+		base, perKg, ok := strings.Cut(arg, "+")
+		if !ok {
+			return nil, fmt.Errorf("shipping: weight rate %q must be base+per_kg", arg)
+		}
+		b, err := money.Parse(base)
+		if err != nil || b < 0 {
+			return nil, fmt.Errorf("shipping: invalid weight base %q", base)
+		}
+		k, err := money.Parse(perKg)
+		if err != nil || k < 0 {
+			return nil, fmt.Errorf("shipping: invalid weight rate %q", perKg)
+		}
+		return WeightBased{Base: b, PerKg: k}, nil
+	case "free_over":
+		threshold, err := money.Parse(arg)
+		if err != nil || threshold < 0 {
+			return nil, fmt.Errorf("shipping: invalid threshold %q", arg)
+		}
+		if strings.TrimSpace(rest) == "" {
+			return nil, fmt.Errorf("shipping: free_over needs a rule after it")
+		}
+		next, err := Parse(rest)
+		if err != nil {
+			return nil, err
+		}
+		return FreeOver{Threshold: threshold, Next: next}, nil
+	default:
+		return nil, fmt.Errorf("shipping: unknown rule %q", name)
+	}
+}
@@ -0,0 +1,77 @@
+package shipping
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/faiisu/ecom-backend/internal/money"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		spec    string
+		want    Calculator
+		wantErr bool
+	}{
+		{spec: "", want: Free{}},
+		{spec: "  ", want: Free{}},
+		{spec: "free", want: Free{}},
+		{spec: "flat:50", want: FlatRate{Amount: money.FromMajor(50)}},
+		{spec: "flat:49.50", want: FlatRate{Amount: 4950}},
+		{spec: "weight:30+15", want: WeightBased{Base: money.FromMajor(30), PerKg: money.FromMajor(15)}},
+		{spec: "free_over:1000,flat:50", want: FreeOver{Threshold: money.FromMajor(1000), Next: FlatRate{Amount: money.FromMajor(50)}}},
+		{spec: "free_over:1000, weight:30+15", want: FreeOver{
+			Threshold: money.FromMajor(1000),
+			Next:      WeightBased{Base: money.FromMajor(30), PerKg: money.FromMajor(15)},
+		}},
+		{spec: "flat", wantErr: true},
+		{spec: "flat:abc", wantErr: true},
+		{spec: "flat:-5", wantErr: true},
+		{spec: "weight:30", wantErr: true},
+		{spec: "weight:x+15", wantErr: true},
+		{spec: "weight:30+-1", wantErr: true},
+		{spec: "free_over:1000", wantErr: true},
+		{spec: "free_over:lots,flat:50", wantErr: true},
+		{spec: "free_over:1000,express:10", wantErr: true},
+		{spec: "express:10", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			got, err := Parse(tt.spec)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Parse(%q) err = %v, want error %v", tt.spec, err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Parse(%q) = %#v, want %#v", tt.spec, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFee(t *testing.T) {
+	weight := WeightBased{Base: money.FromMajor(30), PerKg: money.FromMajor(15)}
+	tests := []struct {
+		name   string
+		rate   Calculator
+		parcel Parcel
+		want   money.Money
+	}{
+		{name: "free", rate: Free{}, parcel: Parcel{Subtotal: money.FromMajor(10)}, want: 0},
+		{name: "flat", rate: FlatRate{Amount: money.FromMajor(50)}, parcel: Parcel{WeightGrams: 5000}, want: money.FromMajor(50)},
+		{name: "weightless", rate: weight, parcel: Parcel{}, want: money.FromMajor(30)},
+		{name: "exactly 1 kg", rate: weight, parcel: Parcel{WeightGrams: 1000}, want: money.FromMajor(45)},
+		{name: "started kg", rate: weight, parcel: Parcel{WeightGrams: 1001}, want: money.FromMajor(60)},
+		{name: "under the threshold", rate: FreeOver{Threshold: money.FromMajor(1000), Next: weight},
+			parcel: Parcel{Subtotal: 99999, WeightGrams: 1}, want: money.FromMajor(45)},
+		{name: "at the threshold", rate: FreeOver{Threshold: money.FromMajor(1000), Next: weight},
+			parcel: Parcel{Subtotal: money.FromMajor(1000), WeightGrams: 1}, want: 0},
+		{name: "threshold without a next rule", rate: FreeOver{Threshold: money.FromMajor(1000)}, parcel: Parcel{}, want: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.rate.Fee(tt.parcel); got != tt.want {
+				t.Errorf("Fee = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,140 @@
+// Package tax holds the tax rates that apply to a sale. Rates depend on the
+// product category and on the region the order ships to, and prices either
+// include the tax or have it added on top.
+package tax
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/faiisu/ecom-backend/internal/money"
+)
+
+// Modes. Inclusive prices already contain the tax; exclusive prices get it
+// added at checkout.
+const (
+	Inclusive = "inclusive"
+	Exclusive = "exclusive"
+)
+
+// Rule is a rate for a product category, a region, or both. An empty field
+// matches anything.
+type Rule struct {
+	Region     string
+	CategoryID string
+	Rate       money.Money // percent
+}
+
+// specificity ranks rules so a category and region rule beats a category
+// rule, which beats a region rule.
+func (r Rule) specificity() int {
+	n := 0
+	if r.CategoryID != "" {
+		n += 2
+	}
+	if r.Region != "" {
+		n++
+	}
+	return n
+}
+
+// Table is a set of rates. The zero Table charges no tax.
+type Table struct {
+	Mode    string
+	Default money.Money // rate when no rule matches
+	Rules   []Rule
+}
+
+// Rate returns the percent that applies to categoryID sold into any of
+// regions, using the most specific matching rule. Regions match
+// case-insensitively; the shipping fee uses an empty categoryID, so only
+// region rules and the default apply to it.
+func (t Table) Rate(categoryID string, regions ...string) money.Money {
+	rate, best := t.Default, -1
+	for _, rule := range t.Rules {
+		if rule.Region != "" && !matchRegion(rule.Region, regions) {
+			continue
+		}
+		if rule.CategoryID != "" && rule.CategoryID != categoryID {
+			continue
+		}
+		if n := rule.specificity(); n > best {
+			rate, best = rule.Rate, n
+		}
+	}
+	return rate
+}
+
+func matchRegion(region string, regions []string) bool {
+	for _, r := range regions {
+		if strings.EqualFold(region, r) {
+			return true
+		}
+	}
+	return false
+}
+
+// Amount returns the tax on amount at rate: the part of it the tax accounts
+// for when prices are inclusive, or the tax to add when they are exclusive.
+func (t Table) Amount(amount, rate money.Money) money.Money {
+	if t.Mode == Exclusive {
+		return amount.Percent(rate)
+	}
+	return amount.IncludedTax(rate)
+}
+
+// Parse builds a table from a mode and a comma separated list of rates, for
+// example:
+//
+//	7                                a default of 7%
+//	category:books=0                 books are not taxed
+//	region:Phuket=8                  8% for orders shipped to Phuket
+//	region:Phuket+category:books=1   both at once
+//
+// Regions match an address's province or country. An empty mode is
+// inclusive and an empty spec charges no tax.
+func Parse(mode, spec string) (Table, error) {
+	t := Table{Mode: Inclusive}
+	if mode != "" {
+		if mode != Inclusive && mode != Exclusive {
+			return Table{}, fmt.Errorf("tax: unknown mode %q", mode)
+		}
+		t.Mode = mode
+	}
+
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		selector, raw, found := strings.Cut(entry, "=")
+		if !found {
+			selector, raw = "", entry
+		}
+		rate, err := money.Parse(strings.TrimSpace(raw))
+		if err != nil || rate < 0 {
+			return Table{}, fmt.Errorf("tax: invalid rate in %q", entry)
+		}
+		if selector == "" || selector == "*" {
+			t.Default = rate
+			continue
+		}
+
+		rule := Rule{Rate: rate}
+		for _, part := range strings.Split(selector, "+") {
+			key, value, _ := strings.Cut(strings.TrimSpace(part), ":")
+			switch {
+			case value == "":
+				return Table{}, fmt.Errorf("tax: invalid selector %q", part)
+			case key == "region":
+				rule.Region = value
+			case key == "category":
+				rule.CategoryID = value
+			default:
+				return Table{}, fmt.Errorf("tax: invalid selector %q", part)
+			}
+		}
+		t.Rules = append(t.Rules, rule)
+	}
+	return t, nil
+}
@@ -0,0 +1,98 @@
+package tax
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/faiisu/ecom-backend/internal/money"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name    string
+		mode    string
+		spec    string
+		want    Table
+		wantErr bool
+	}{
+		{name: "empty", want: Table{Mode: Inclusive}},
+		{name: "default rate", spec: "7", want: Table{Mode: Inclusive, Default: money.FromMajor(7)}},
+		{name: "star default", mode: Exclusive, spec: "*=7.5", want: Table{Mode: Exclusive, Default: 750}},
+		{
+			name: "rules",
+			spec: " 7, category:books=0 ,region:Phuket=8,region:Phuket+category:books=1",
+			want: Table{Mode: Inclusive, Default: money.FromMajor(7), Rules: []Rule{
+				{CategoryID: "books", Rate: 0},
+				{Region: "Phuket", Rate: money.FromMajor(8)},
+				{Region: "Phuket", CategoryID: "books", Rate: money.FromMajor(1)},
+			}},
+		},
+		{name: "unknown mode", mode: "included", spec: "7", wantErr: true},
+		{name: "bad rate", spec: "seven", wantErr: true},
+		{name: "negative rate", spec: "category:books=-1", wantErr: true},
+		{name: "unknown selector", spec: "brand:acme=5", wantErr: true},
+		{name: "selector without value", spec: "region:=5", wantErr: true},
+		{name: "selector without key", spec: "books=5", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Parse(tt.mode, tt.spec)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Parse(%q, %q) err = %v, want error %v", tt.mode, tt.spec, err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Parse(%q, %q) = %+v, want %+v", tt.mode, tt.spec, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRate(t *testing.T) {
+	table, err := Parse("", "7,category:books=0,region:Phuket=8,region:Phuket+category:books=1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name       string
+		categoryID string
+		regions    []string
+		want       money.Money
+	}{
+		{name: "default", categoryID: "mugs", want: money.FromMajor(7)},
+		{name: "category", categoryID: "books", regions: []string{"Bangkok", "Thailand"}, want: 0},
+		{name: "region, any case", categoryID: "mugs", regions: []string{"phuket", "Thailand"}, want: money.FromMajor(8)},
+		{name: "category and region beat either", categoryID: "books", regions: []string{"Phuket"}, want: money.FromMajor(1)},
+		{name: "shipping only sees region rules", regions: []string{"Phuket"}, want: money.FromMajor(8)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := table.Rate(tt.categoryID, tt.regions...); got != tt.want {
+				t.Errorf("Rate = %s, want %s", got, tt.want)
+			}
+		})
+	}
+
+	if got := (Table{}).Rate("books", "Phuket"); got != 0 {
+		t.Errorf("zero Table rate = %s, want 0", got)
+	}
+}
+
+func TestAmount(t *testing.T) {
+	tests := []struct {
+		mode         string
+		amount, rate money.Money
+		want         money.Money
+	}{
+		{mode: Inclusive, amount: money.FromMajor(107), rate: money.FromMajor(7), want: money.FromMajor(7)},
+		{mode: Inclusive, amount: money.FromMajor(100), rate: money.FromMajor(7), want: 654},
+		{mode: "", amount: money.FromMajor(100), rate: money.FromMajor(7), want: 654},
+		{mode: Exclusive, amount: money.FromMajor(100), rate: money.FromMajor(7), want: money.FromMajor(7)},
+		{mode: Exclusive, amount: 8999, rate: money.FromMajor(7), want: 630},
+		{mode: Exclusive, amount: money.FromMajor(100), rate: 0, want: 0},
+	}
+	for _, tt := range tests {
+		if got := (Table{Mode: tt.mode}).Amount(tt.amount, tt.rate); got != tt.want {
+			t.Errorf("%s Amount(%s, %s) = %s, want %s", tt.mode, tt.amount, tt.rate, got, tt.want)
+		}
+	}
+}
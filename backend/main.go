@@ -2,11 +2,16 @@ package main
 
 import (
 	"log"
+	"time"
 
 	_ "github.com/faiisu/ecom-backend/docs"
 	"github.com/faiisu/ecom-backend/internal/config"
 	"github.com/faiisu/ecom-backend/internal/db"
+	"github.com/faiisu/ecom-backend/internal/handlers"
+	"github.com/faiisu/ecom-backend/internal/payment"
 	"github.com/faiisu/ecom-backend/internal/routes"
+	"github.com/faiisu/ecom-backend/internal/shipping"
+	"github.com/faiisu/ecom-backend/internal/tax"
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/fiber/v2/middleware/cors"
 	swagger "github.com/gofiber/swagger"
@@ -22,12 +27,54 @@ func main() {
 	if err := db.ConnectMongo(cfg.MongoURL, cfg.MongoDBName); err != nil {
 		log.Fatalf("failed to connect to MongoDB: %v", err)
 	}
+	if err := db.MigrateMoney(); err != nil {
+		log.Fatalf("failed to migrate money fields: %v", err)
+	}
+	if err := db.MigrateCartItems(); err != nil {
+		log.Fatalf("failed to merge cart items: %v", err)
+	}
+	if err := db.EnsureIndexes(); err != nil {
+		log.Fatalf("failed to create indexes: %v", err)
+	}
+	if err := db.MigrateOrders(); err != nil {
+		log.Fatalf("failed to migrate orders: %v", err)
+	}
+	handlers.IdempotencyTTL = cfg.IdempotencyTTL
+	handlers.ReservationTTL = cfg.ReservationTTL
+	go handlers.SweepReservations(time.Minute)
+	switch cfg.PaymentProvider {
+	case "fake":
+		fake := payment.NewFake(cfg.PaymentWebhookSecret)
+		fake.WebhookURL = cfg.PaymentWebhookURL
+		if err := fake.Configure(cfg.PaymentFakeOutcomes); err != nil {
+			log.Fatalf("invalid PAYMENT_FAKE_OUTCOMES: %v", err)
+		}
+		handlers.Payments = fake
+	default:
+		log.Fatalf("unknown PAYMENT_PROVIDER %q", cfg.PaymentProvider)
+	}
+	go handlers.ReconcilePayments(time.Minute)
+	rates, err := shipping.Parse(cfg.ShippingRates)
+	if err != nil {
+		log.Fatalf("invalid SHIPPING_RATES: %v", err)
+	}
+	handlers.Shipping = rates
+	taxes, err := tax.Parse(cfg.TaxMode, cfg.TaxRates)
+	if err != nil {
+		log.Fatalf("invalid TAX_MODE or TAX_RATES: %v", err)
+	}
+	handlers.Taxes = taxes
+	merge, err := handlers.ParseGuestMergePolicy(cfg.GuestMergeCampaigns, cfg.GuestMergePoints)
+	if err != nil {
+		log.Fatalf("invalid GUEST_MERGE_CAMPAIGNS or GUEST_MERGE_POINTS: %v", err)
+	}
+	handlers.GuestMerge = merge
 	app := fiber.New()
 
 	app.Use(cors.New(cors.Config{
 		AllowOrigins: "http://localhost:3001 ,http://192.168.1.5:3001,http://167.71.218.173:3001,http://167.71.218.173:8081",
 		AllowMethods: "GET,POST,HEAD,PUT,DELETE,PATCH,OPTIONS",
-		AllowHeaders: "Origin, Content-Type, Accept, Authorization",
+		AllowHeaders: "Origin, Content-Type, Accept, Authorization, Idempotency-Key",
 	}))
 
 	app.Get("/swagger/*", swagger.HandlerDefault)
@@ -19,6 +19,7 @@ interface CampaignCategory {
     name: string;
     description: string;
     rank?: number;
+    allow_multiple?: boolean;
 }
 
 interface CartItem {
@@ -65,7 +66,10 @@ const CampaignSelectionModal: React.FC<CampaignSelectionModalProps> = ({ isOpen,
             setSelected(selected.filter(c => c.id !== campaign.id));
         } else {
             // Check for category conflict
-            const conflictingCampaign = selected.find(c => c.campaign_category_id === campaign.campaign_category_id);
+            const category = categories.find(c => c.id === campaign.campaign_category_id);
+            const conflictingCampaign = category?.allow_multiple
+                ? undefined
+                : selected.find(c => c.campaign_category_id === campaign.campaign_category_id);
 
             if (conflictingCampaign) {
                 // Replace the conflicting campaign with the new one
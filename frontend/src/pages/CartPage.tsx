@@ -1,15 +1,23 @@
 import React, { useEffect, useState } from 'react';
-import { FaShoppingBag, FaTrash, FaTag } from 'react-icons/fa';
+import { FaShoppingBag, FaTrash, FaTag, FaMinus, FaPlus } from 'react-icons/fa';
 import { Link } from 'react-router-dom';
 import CampaignSelectionModal from '../components/CampaignSelectionModal';
 
 interface CartItem {
-    _id: string;
     id: string;
     product_id: string;
     product_name: string;
     product_price: number;
     quantity: number;
+    line_total: number;
+    available: boolean;
+}
+
+interface Quote {
+    subtotal: number;
+    total: number;
+    point_used: number;
+    campaigns: { campaign_id: string; name: string; amount: number }[] | null;
 }
 
 interface Product {
@@ -62,11 +70,6 @@ const CartPage: React.FC = () => {
 
     const backendUrl = import.meta.env.VITE_BACKEND_URL || '';
 
-    const getSubtotal = () => {
-        const subtotal = cartItems.reduce((total, item) => total + (item.product_price * item.quantity), 0);
-        return subtotal;
-    };
-
     useEffect(() => {
         const fetchData = async () => {
             const guestId = localStorage.getItem('guestId');
@@ -81,7 +84,12 @@ const CartPage: React.FC = () => {
                 const cartResponse = await fetch(`${backendUrl}/cart/${guestId}`);
                 if (cartResponse.ok) {
                     const cartData = await cartResponse.json();
-                    setCartItems(Array.isArray(cartData) ? cartData : []);
+                    setCartItems(Array.isArray(cartData.items) ? cartData.items : []);
+                    // Campaigns attached to the cart are kept by the server, which also prices the cart
+                    setSelectedCampaigns(Array.isArray(cartData.campaigns) ? cartData.campaigns : []);
+                    if (cartData.preview) {
+                        applyQuote(cartData.preview);
+                    }
                 }
 
                 // Fetch Products (to get category info)
@@ -127,116 +135,85 @@ const CartPage: React.FC = () => {
         fetchData();
     }, []);
 
-    useEffect(() => {
-        setSubtotal(getSubtotal());
-        setFinalTotal(getSubtotal());
-    }, [cartItems]);
-
-    const calculateDiscount = (currentCampaigns: Campaign[], currentCartItems: CartItem[]) => {
-        let totalDiscount = 0;
-        const breakdown: { id: string; name: string; amount: number }[] = [];
-
-        // Create a working copy with mutable current_price
-        let workingItems = currentCartItems.map(item => ({
-            ...item,
-            current_unit_price: item.product_price
-        }));
-
-        currentCampaigns.forEach(campaign => {
-            // Identify eligible items for this campaign
-            const eligibleIndices: number[] = [];
-
-            workingItems.forEach((item, index) => {
-                // If campaign has no specific product categories, it applies to all
-                if (!campaign.product_categories || campaign.product_categories.length === 0) {
-                    eligibleIndices.push(index);
-                    return;
-                }
-                // Find product details to check category
-                const product = products.find(p => p.id === item.product_id);
-                if (!product) return;
+    const previewCheckout = async (campaignIds: string[], pointUsed: number) => {
+        const guestId = localStorage.getItem('guestId');
+        if (!guestId) return;
 
-                // Check if product's category is in the campaign's target list
-                if (campaign.product_categories.some(pc => pc.id === product.product_category_id)) {
-                    eligibleIndices.push(index);
-                }
+        try {
+            const response = await fetch(`${backendUrl}/checkout/preview`, {
+                method: 'POST',
+                headers: {
+                    'Content-Type': 'application/json',
+                },
+                body: JSON.stringify({
+                    campaign_ids: campaignIds,
+                    user_id: guestId,
+                    point_used: pointUsed,
+                }),
             });
+            if (!response.ok) {
+                // e.g. campaigns from the same exclusive category
+                const data = await response.json().catch(() => ({}));
+                setError(data.error || 'Failed to price cart');
+                return;
+            }
 
-            // Calculate base amount from eligible items using CURRENT price
-            const eligibleAmount = eligibleIndices.reduce((sum, index) => {
-                const item = workingItems[index];
-                return sum + (item.current_unit_price * item.quantity);
-            }, 0);
-
-            if (eligibleAmount > 0) {
-                let discountAmount = 0;
-
-                switch (campaign.discount_type) {
-                    case 'fixed':
-                        discountAmount = campaign.discount_value;
-                        if (eligibleAmount < discountAmount) discountAmount = eligibleAmount;
-                        break;
-                    case 'percent':
-                        discountAmount = (eligibleAmount * campaign.discount_value) / 100;
-                        break;
-                    case 'spendAndSave':
-                        if (campaign.every && campaign.every > 0) {
-                            const times = Math.floor(eligibleAmount / campaign.every);
-                            discountAmount = times * campaign.discount_value;
-                        }
-                        break;
-                    case 'points':
-                        const guestPointsStr = localStorage.getItem('guestPoints');
-                        let AvaliablePoint = guestPointsStr ? parseInt(guestPointsStr, 10) : 0;
-
-                        if (campaign.limit !== undefined && (AvaliablePoint / eligibleAmount) * 100 > campaign.limit) {
-                            AvaliablePoint = campaign.limit * eligibleAmount / 100;
-                        }
-                        discountAmount = AvaliablePoint;
-                        break;
-                }
-
-                // Ensure discount doesn't exceed eligible amount
-                discountAmount = Math.min(discountAmount, eligibleAmount);
-
-                if (discountAmount > 0) {
-                    totalDiscount += discountAmount;
-                    breakdown.push({ id: campaign.id, name: campaign.name, amount: discountAmount });
-
-                    // DISTRIBUTE DISCOUNT
-                    const ratio = discountAmount / eligibleAmount;
+            setError(null);
+            applyQuote(await response.json());
+        } catch (err) {
+            console.error('Error previewing checkout:', err);
+            setError('Failed to price cart');
+        }
+    };
 
-                    eligibleIndices.forEach(index => {
-                        const item = workingItems[index];
-                        // Reduce price by ratio
-                        item.current_unit_price = item.current_unit_price * (1 - ratio);
-                    });
-                }
-            }
+    // Show the server quote so the summary matches what checkout charges. Tax and
+    // shipping move the total too, so the discount is what the campaigns saved,
+    // points included.
+    const applyQuote = (quote: Quote) => {
+        const campaigns = quote.campaigns || [];
+        setSubtotal(quote.subtotal);
+        setFinalTotal(quote.total);
+        setUsedPoint(quote.point_used);
+        setDiscountData({
+            totalDiscount: campaigns.reduce((total, c) => total + c.amount, 0),
+            breakdown: campaigns.map(c => ({ id: c.campaign_id, name: c.name, amount: c.amount })),
+            pointsUsed: quote.point_used,
         });
+    };
 
-        setFinalTotal(workingItems.reduce((sum, item) => sum + item.current_unit_price * item.quantity, 0));
+    const syncCartCampaigns = async (newSelectedCampaigns: Campaign[]) => {
+        const guestId = localStorage.getItem('guestId');
+        if (!guestId) return;
 
-        // Calculate points used
-        let pointsUsed = 0;
-        currentCampaigns.forEach(campaign => {
-            if (campaign.discount_type === 'points') {
-                const breakdownItem = breakdown.find(b => b.id === campaign.id);
-                if (breakdownItem) {
-                    pointsUsed += breakdownItem.amount;
+        const newIds = newSelectedCampaigns.map(c => c.id);
+        const oldIds = selectedCampaigns.map(c => c.id);
+        try {
+            for (const id of oldIds.filter(id => !newIds.includes(id))) {
+                await fetch(`${backendUrl}/cart/${guestId}/campaigns/${id}`, { method: 'DELETE' });
+            }
+            for (const id of newIds.filter(id => !oldIds.includes(id))) {
+                const response = await fetch(`${backendUrl}/cart/${guestId}/campaigns`, {
+                    method: 'POST',
+                    headers: {
+                        'Content-Type': 'application/json',
+                    },
+                    body: JSON.stringify({ campaign_id: id }),
+                });
+                if (!response.ok) {
+                    const data = await response.json().catch(() => ({}));
+                    setError(data.error || 'Failed to apply campaign');
                 }
             }
-        });
-
-        setUsedPoint(pointsUsed);
-
-        return { totalDiscount, breakdown, pointsUsed };
+        } catch (err) {
+            console.error('Error saving campaigns:', err);
+        }
     };
 
     const handleApplyCampaigns = (newSelectedCampaigns: Campaign[]) => {
+        syncCartCampaigns(newSelectedCampaigns);
         setSelectedCampaigns(newSelectedCampaigns);
-        const result = calculateDiscount(newSelectedCampaigns, cartItems);
-        setDiscountData(result);
+        // Point redemption is decided by the server, 0 means no extra limit
+        previewCheckout(newSelectedCampaigns.map(c => c.id), 0);
         setIsCampaignModalOpen(false);
     };
 
@@ -271,6 +248,39 @@ const CartPage: React.FC = () => {
         window.location.reload();
     };
 
+    const handleSetQuantity = async (productId: string, quantity: number) => {
+        const guestId = localStorage.getItem('guestId');
+        if (!guestId) return;
+
+        try {
+            const response = await fetch(`${backendUrl}/cart`, {
+                method: 'PATCH',
+                headers: {
+                    'Content-Type': 'application/json',
+                },
+                body: JSON.stringify({
+                    user_id: guestId,
+                    product_id: productId,
+                    quantity,
+                }),
+            });
+
+            if (response.ok) {
+                setCartItems(prev => quantity === 0
+                    ? prev.filter(item => item.product_id !== productId)
+                    : prev.map(item => item.product_id === productId ? { ...item, quantity, line_total: item.product_price * quantity } : item));
+                // Totals always come from the server, which adds tax and shipping
+                previewCheckout(selectedCampaigns.map(c => c.id), 0);
+            } else {
+                const data = await response.json().catch(() => ({}));
+                setError(data.error || 'Failed to update quantity');
+            }
+        } catch (error) {
+            console.error('Error updating quantity:', error);
+            setError('Error updating quantity');
+        }
+    };
+
     const handleCheckout = async () => {
         const guestId = localStorage.getItem('guestId');
         if (!guestId) {
@@ -284,19 +294,21 @@ const CartPage: React.FC = () => {
                 headers: {
                     'Content-Type': 'application/json',
                 },
+                // Without campaign_ids checkout uses the campaigns attached to the cart
                 body: JSON.stringify({
-                    campaign_ids: selectedCampaigns.map(c => c.id),
                     user_id: guestId,
-                    point_used: usedPoint || 0,
+                    point_used: 0,
                 }),
             });
 
             if (response.ok) {
-                alert('Checkout successful!');
+                const result = await response.json();
+                // 202 means the order waits for the payment provider to confirm
+                alert(response.status === 202 ? 'Order placed, payment is processing.' : 'Checkout successful!');
 
-                // Deduct used points from localStorage
+                // Deduct the points the server actually redeemed from localStorage
                 const currentPoints = parseInt(localStorage.getItem('guestPoints') || '0', 10);
-                const pointsToDeduct = usedPoint || 0;
+                const pointsToDeduct = result.point_used || 0;
                 const newPoints = Math.max(0, currentPoints - pointsToDeduct);
                 localStorage.setItem('guestPoints', newPoints.toString());
 
@@ -315,7 +327,7 @@ const CartPage: React.FC = () => {
                 window.location.reload();
             } else {
                 const data = await response.json();
-                alert(`Checkout failed: ${data.message || 'Unknown error'}`);
+                alert(`Checkout failed: ${data.error || data.message || 'Unknown error'}`);
             }
         } catch (error) {
             console.error('Error during checkout:', error);
@@ -388,7 +400,7 @@ const CartPage: React.FC = () => {
                         {/* Cart Items List */}
                         <div className="lg:col-span-2 space-y-4">
                             {cartItems.map((item) => (
-                                <div key={item._id || item.id} className="bg-white rounded-xl shadow-sm p-6 flex items-center gap-6">
+                                <div key={item.id} className="bg-white rounded-xl shadow-sm p-6 flex items-center gap-6">
                                     <div className="w-24 h-24 bg-gray-100 rounded-lg flex-shrink-0 overflow-hidden">
                                         <img
                                             src="https://images.unsplash.com/photo-1523275335684-37898b6baf30?ixlib=rb-4.0.3&auto=format&fit=crop&w=1000&q=80"
@@ -399,12 +411,31 @@ const CartPage: React.FC = () => {
                                     <div className="flex-1">
                                         <h3 className="text-lg font-semibold text-gray-900 mb-1">{item.product_name}</h3>
                                         <p className="text-indigo-600 font-medium">฿{item.product_price.toFixed(2)}</p>
+                                        {!item.available && (
+                                            <p className="text-sm text-red-600 mt-1">No longer available</p>
+                                        )}
                                     </div>
                                     <div className="flex items-center gap-6">
                                         <div className="flex flex-col items-end">
-                                            <span className="text-sm text-gray-500">Qty: {item.quantity}</span>
+                                            <div className="flex items-center gap-2 text-sm text-gray-500">
+                                                <button
+                                                    onClick={() => handleSetQuantity(item.product_id, item.quantity - 1)}
+                                                    className="p-1 text-gray-400 hover:text-indigo-600 transition-colors"
+                                                    title="Decrease quantity"
+                                                >
+                                                    <FaMinus />
+                                                </button>
+                                                <span>Qty: {item.quantity}</span>
+                                                <button
+                                                    onClick={() => handleSetQuantity(item.product_id, item.quantity + 1)}
+                                                    className="p-1 text-gray-400 hover:text-indigo-600 transition-colors"
+                                                    title="Increase quantity"
+                                                >
+                                                    <FaPlus />
+                                                </button>
+                                            </div>
                                             <span className="text-lg font-bold text-gray-900 mt-1">
-                                                ฿{(item.product_price * item.quantity).toFixed(2)}
+                                                ฿{item.line_total.toFixed(2)}
                                             </span>
                                         </div>
                                         <button
@@ -451,6 +482,13 @@ const CartPage: React.FC = () => {
                                         </div>
                                     )}
 
+                                    {usedPoint > 0 && (
+                                        <div className="flex justify-between text-sm text-gray-600">
+                                            <span>Points redeemed</span>
+                                            <span>{usedPoint}</span>
+                                        </div>
+                                    )}
+
                                     <div className="border-t border-gray-100 pt-4 flex justify-between text-lg font-bold text-gray-900">
                                         <span>Total</span>
                                         <span>฿{finalTotal.toFixed(2)}</span>